@@ -16,6 +16,7 @@ type base struct {
 	baseChain alice.Chain
 	timer     middleware.Timer
 	logger    middleware.Logger
+	policies  *middleware.PolicySet
 }
 
 // NewBase gets a new measurer with the provided base chain
@@ -39,10 +40,23 @@ func NewBaseWithExtras(b alice.Chain, timer middleware.Timer, logger middleware.
 	return &base{baseChain: c, timer: timer, logger: logger}
 }
 
-// Measure returns a chain that will have metrics measured
+// NewBaseWithPolicies is similar to NewBaseWithExtras but enforces the policy for each measured route. Auth (or
+// AuthOptional when some routes are public) should be one of the constructors so the policies can see the claims
+func NewBaseWithPolicies(b alice.Chain, timer middleware.Timer, logger middleware.Logger, jwtDecoder middleware.JWTDecoder, policies *middleware.PolicySet, constructors ...alice.Constructor) Measurer {
+	c := b.Append(middleware.Recovery, middleware.NewUserIDInjector(jwtDecoder).Inject, middleware.RequestID)
+	c = c.Append(constructors...)
+	return &base{baseChain: c, timer: timer, logger: logger, policies: policies}
+}
+
+// Measure returns a chain that will have metrics measured. The route name is put in the context first so the
+// base chain and extra constructors can make per route decisions too
 func (b *base) Measure(name string, handler http.Handler) http.HandlerFunc {
+	c := alice.New(middleware.RouteName(name)).Extend(b.baseChain)
 	if b.timer != nil {
-		return b.baseChain.Append(b.timer.Time(name)).Append(b.logger.Log).Then(handler).ServeHTTP
+		c = c.Append(b.timer.Time(name)).Append(b.logger.Log)
+	}
+	if b.policies != nil {
+		c = c.Append(b.policies.Enforce(name))
 	}
-	return b.baseChain.Then(handler).ServeHTTP
+	return c.Then(handler).ServeHTTP
 }
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/promoboxx/go-service/service"
+)
+
+// AdminOnly only lets requests with admin or system claims through, it should be placed after Auth
+func AdminOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := GetClaimsFromCtx(r.Context())
+		if err != nil {
+			service.WriteProblem(w, "Could not find claims", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+			return
+		}
+		if !claims.IsAdmin() {
+			service.WriteProblem(w, "Admin access is required", "FORBIDDEN", http.StatusForbidden, errors.New("not an admin"))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/service"
+)
+
+const (
+	// HeaderAPIKey holds an API key, it can also be sent as "Authorization: ApiKey <key>"
+	HeaderAPIKey = "X-API-Key"
+
+	authSchemeAPIKey = "ApiKey "
+
+	defaultAPIKeyClaimLifetime = time.Hour
+	defaultAPIKeyUsedInterval  = time.Minute
+	apiKeyUsedTimeout          = 5 * time.Second
+)
+
+// ErrEmptyPepper is the panic of APIKeyAuth and HashAPIKey when there is no pepper
+var ErrEmptyPepper = errors.New("an API key pepper is required")
+
+// APIKey is what an API key grants, it becomes the claims of the requests made with it
+type APIKey struct {
+	ID        string
+	Name      string
+	UserID    int64
+	UserUUID  string
+	Roles     []string
+	Brands    []int64
+	Retailers []int64
+	// ExpiresAt is when the key stops working, zero never expires
+	ExpiresAt time.Time
+}
+
+// APIKeyStore looks up API keys by their hash (see HashAPIKey)
+type APIKeyStore interface {
+	// GetAPIKey returns the key with the hash, ok is false if there isn't one
+	GetAPIKey(ctx context.Context, hash string) (key APIKey, ok bool, err error)
+	// MarkAPIKeyUsed records when the key was last used
+	MarkAPIKeyUsed(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// APIKeyConfig holds the optional behavior of APIKeyAuth
+type APIKeyConfig struct {
+	// Pepper is the secret the keys are hashed with, it must be the same one the keys were stored with.
+	// It's required, APIKeyAuth panics without it
+	Pepper []byte
+	// Fallback handles requests that don't have an API key, like Auth(token) to also accept JWTs.
+	// Requests without an API key get a 401 when it's nil
+	Fallback func(http.Handler) http.Handler
+	// UsedInterval limits how often the last used time of a key is recorded, defaults to a minute
+	UsedInterval time.Duration
+}
+
+type apiKeyAuth struct {
+	store  APIKeyStore
+	config APIKeyConfig
+
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+// HashAPIKey hashes the key with an HMAC-SHA256 keyed by the pepper. The hash has to be the same every time so keys
+// can be looked up by it, which rules out salted hashes like bcrypt. Keys are random so they don't need a slow hash
+// to resist guessing, the pepper keeps a leaked table of hashes from being checked offline. It panics if the pepper
+// is empty since the hashes wouldn't be keyed by anything secret
+func HashAPIKey(key string, pepper []byte) string {
+	if len(pepper) == 0 {
+		panic(ErrEmptyPepper)
+	}
+
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// APIKeyAuth authenticates requests with an API key sent in the X-API-Key header or as "Authorization: ApiKey <key>".
+// The claims are built from the key's roles, brands and retailers and put in the context like Auth does, so permission
+// checks work the same. The time each key was last used is recorded in the background
+func APIKeyAuth(store APIKeyStore, config APIKeyConfig) func(http.Handler) http.Handler {
+	if len(config.Pepper) == 0 {
+		panic(ErrEmptyPepper)
+	}
+	if config.UsedInterval == 0 {
+		config.UsedInterval = defaultAPIKeyUsedInterval
+	}
+	a := &apiKeyAuth{store: store, config: config, lastUsed: map[string]time.Time{}}
+
+	return func(next http.Handler) http.Handler {
+		var fallback http.Handler
+		if config.Fallback != nil {
+			fallback = config.Fallback(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rawKey := apiKeyFromRequest(r)
+			if rawKey == "" {
+				if fallback != nil {
+					fallback.ServeHTTP(w, r)
+					return
+				}
+				service.WriteProblem(w, "Could not find API key", "NOT_AUTHORIZED", http.StatusUnauthorized, errors.New("no API key"))
+				return
+			}
+
+			key, ok, err := store.GetAPIKey(r.Context(), HashAPIKey(rawKey, config.Pepper))
+			if err != nil {
+				service.WriteProblem(w, "Could not look up API key", "API_KEY_LOOKUP_FAILED", http.StatusInternalServerError, err)
+				return
+			}
+			now := time.Now()
+			if !ok || (!key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt)) {
+				service.WriteProblem(w, "Could not validate API key", "NOT_AUTHORIZED", http.StatusUnauthorized, errors.New("unknown or expired API key"))
+				return
+			}
+
+			a.markUsed(r.Context(), key.ID, now)
+
+			expiration := key.ExpiresAt
+			if expiration.IsZero() || expiration.After(now.Add(defaultAPIKeyClaimLifetime)) {
+				expiration = now.Add(defaultAPIKeyClaimLifetime)
+			}
+			claims := auth.NewClaim(key.Brands, nil, nil, expiration, nil, key.Retailers, key.Roles, key.UserID, key.UserUUID, 0, "", nil)
+
+			ctx := setIdentity(r.Context(), Identity{UserID: key.UserID, UserUUID: key.UserUUID, APIKeyID: key.ID, Method: AuthMethodAPIKey, Verified: true})
+			ctx = claimsKey.WithValue(ctx, claims)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiKeyFromRequest returns the API key from the X-API-Key or Authorization header
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+	if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, authSchemeAPIKey) {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, authSchemeAPIKey))
+	}
+	return ""
+}
+
+// markUsed records the key was used in the background, at most once per UsedInterval so busy keys don't cause a write per request
+func (a *apiKeyAuth) markUsed(ctx context.Context, id string, now time.Time) {
+	a.mu.Lock()
+	if now.Sub(a.lastUsed[id]) < a.config.UsedInterval {
+		a.mu.Unlock()
+		return
+	}
+	a.lastUsed[id] = now
+	a.mu.Unlock()
+
+	logger := MustGetLoggerFromContext(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), apiKeyUsedTimeout)
+		defer cancel()
+
+		if err := a.store.MarkAPIKeyUsed(ctx, id, now); err != nil {
+			logger.WithError(err).Printf("Could not record API key %s was used", id)
+		}
+	}()
+}
@@ -5,22 +5,36 @@ import (
 	"net/http"
 
 	"github.com/promoboxx/go-auth/src/auth"
-	"github.com/promoboxx/go-service/alice/middleware/contextkey"
 	"github.com/promoboxx/go-service/service"
 )
 
+// AuthConfig holds the optional behavior of Auth and AuthOptional
+type AuthConfig struct {
+	// Revocations is checked after the token is validated, revoked tokens get a 401 TOKEN_REVOKED
+	Revocations RevocationChecker
+	// RevocationFailOpen lets requests through when the revocation check fails instead of returning a 500
+	RevocationFailOpen bool
+	// Session reads the JWT from the session cookie when there is no Authorization header, see SetSessionCookie.
+	// Unsafe requests authenticated with the cookie must have the CSRF token of the same config
+	Session *SessionCookieConfig
+}
+
 func Auth(token auth.Token) func(http.Handler) http.Handler {
+	return AuthWithConfig(token, AuthConfig{})
+}
+
+// AuthWithConfig is like Auth with the optional behavior in config
+func AuthWithConfig(token auth.Token, config AuthConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			jwt := r.Header.Get("Authorization")
-			claims, err := token.ValidateJWT(jwt)
-			if err != nil {
-				service.WriteProblem(w, "Could not validate JWT", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+			jwt, ok := jwtFromRequest(w, r, config)
+			if !ok {
+				return
+			}
+			ctx, ok := authenticate(w, r, token, config, jwt)
+			if !ok {
 				return
 			}
-
-			ctx := context.WithValue(r.Context(), contextkey.ContextKeyClaims, claims)
-			ctx = context.WithValue(ctx, contextkey.ContextKeyJWT, jwt)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -30,25 +44,68 @@ func Auth(token auth.Token) func(http.Handler) http.Handler {
 // Attempts to get the auth token from the HTTP Authorization header, decrypt it, and place it on the context, but allows
 // requests through even if they don't have this header field
 func AuthOptional(token auth.Token) func(http.Handler) http.Handler {
+	return AuthOptionalWithConfig(token, AuthConfig{})
+}
+
+// AuthOptionalWithConfig is like AuthOptional with the optional behavior in config
+func AuthOptionalWithConfig(token auth.Token, config AuthConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authRaw := r.Header.Get("Authorization")
+			authRaw, ok := jwtFromRequest(w, r, config)
+			if !ok {
+				return
+			}
 
 			if len(authRaw) == 0 {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			claims, err := token.ValidateJWT(authRaw)
-			if err != nil {
-				service.WriteProblem(w, "Could not validate JWT", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+			ctx, ok := authenticate(w, r, token, config, authRaw)
+			if !ok {
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), contextkey.ContextKeyClaims, claims)
-			ctx = context.WithValue(ctx, contextkey.ContextKeyJWT, authRaw)
-
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// jwtFromRequest returns the Authorization header, or the session cookie when there is no header and it's configured.
+// A JWT from the cookie is only returned with a valid CSRF token on unsafe requests, otherwise the problem is written
+// and ok is false
+func jwtFromRequest(w http.ResponseWriter, r *http.Request, config AuthConfig) (jwt string, ok bool) {
+	if jwt := r.Header.Get("Authorization"); jwt != "" || config.Session == nil {
+		return jwt, true
+	}
+
+	session := config.Session.withDefaults()
+	cookie, err := r.Cookie(session.Name)
+	if err != nil {
+		return "", true
+	}
+	if !safeMethods[r.Method] && !validCSRFToken(r, session) {
+		writeCSRFProblem(w)
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// authenticate validates the jwt and returns a context with its claims, writing the problem if it's not valid
+func authenticate(w http.ResponseWriter, r *http.Request, token auth.Token, config AuthConfig, jwt string) (context.Context, bool) {
+	claims, err := token.ValidateJWT(jwt)
+	if err != nil {
+		service.WriteProblem(w, "Could not validate JWT", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+		return nil, false
+	}
+
+	if checkRevoked(w, r, config, jwt, claims.GetUserUUID()) {
+		return nil, false
+	}
+
+	ctx := setIdentity(r.Context(), identityFromClaims(claims))
+	ctx = claimsKey.WithValue(ctx, claims)
+	ctx = jwtKey.WithValue(ctx, jwt)
+
+	return ctx, true
+}
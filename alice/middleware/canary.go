@@ -2,25 +2,182 @@ package middleware
 
 import (
 	"context"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"time"
 
-	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/opentracing/opentracing-go"
+	"github.com/promoboxx/go-auth/src/auth"
 )
 
 const (
 	HeaderCanaryVersion = "X-Canary-Version"
+
+	// CookieCanaryVersion is the default cookie used to keep anonymous clients on the same version
+	CookieCanaryVersion = "canary_version"
+
+	defaultCanaryCookieMaxAge = 24 * time.Hour
+	canaryCookieStable        = "stable"
 )
 
+// CanaryConfig configures how the canary middleware assigns a version to requests that don't
+// arrive with one in the X-Canary-Version header
+type CanaryConfig struct {
+	// Version is the canary version, no versions are assigned when it's empty
+	Version string
+	// StableVersion is the version for requests that are not routed to the canary, when it's empty
+	// those requests are left without a version
+	StableVersion string
+	// Percentage (0-100) of users routed to the canary
+	Percentage float64
+	// AllowUserIDs are always routed to the canary, they are matched against the user ID and UUID
+	// from the claims so the middleware must run after Auth
+	AllowUserIDs []string
+	// AllowBrandIDs are always routed to the canary, this needs the claims so the middleware must run after Auth
+	AllowBrandIDs []int64
+	// CookieName is the cookie that keeps requests without a user on the same version, defaults to CookieCanaryVersion
+	CookieName string
+	// CookieMaxAge is how long the cookie lasts, defaults to a day
+	CookieMaxAge time.Duration
+	// InsecureCookie leaves Secure off the cookie so it's kept over plain http, like when running locally
+	InsecureCookie bool
+}
+
+type canaryAssigner struct {
+	config        CanaryConfig
+	allowUserIDs  map[string]bool
+	allowBrandIDs map[int64]bool
+}
+
+// DetermineCanaryMiddlewareFunc copies the canary version from the X-Canary-Version header into the context
 func DetermineCanaryMiddlewareFunc() func(http.Handler) http.Handler {
+	return DetermineCanaryMiddlewareFuncWithConfig(CanaryConfig{})
+}
+
+// DetermineCanaryMiddlewareFuncWithConfig uses the X-Canary-Version header when it's sent, otherwise it assigns
+// a version from the config. Allowlisted users and brands always get the canary, users are split by a hash of
+// their ID so they stay on the same version, and requests without a user are split randomly and kept on their
+// version with a cookie. The version is put in the context, the response header, the request log and the active span
+func DetermineCanaryMiddlewareFuncWithConfig(config CanaryConfig) func(http.Handler) http.Handler {
+	if config.CookieName == "" {
+		config.CookieName = CookieCanaryVersion
+	}
+	if config.CookieMaxAge == 0 {
+		config.CookieMaxAge = defaultCanaryCookieMaxAge
+	}
+
+	c := &canaryAssigner{
+		config:        config,
+		allowUserIDs:  make(map[string]bool, len(config.AllowUserIDs)),
+		allowBrandIDs: make(map[int64]bool, len(config.AllowBrandIDs)),
+	}
+	for _, userID := range config.AllowUserIDs {
+		c.allowUserIDs[userID] = true
+	}
+	for _, brandID := range config.AllowBrandIDs {
+		c.allowBrandIDs[brandID] = true
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			version := r.Header.Get(HeaderCanaryVersion)
+			if version == "" && c.config.Version != "" {
+				version = c.assign(w, r)
+			}
+
 			if version != "" {
-				ctx := context.WithValue(r.Context(), contextkey.ContextKeyCanary, version)
+				ctx := canaryKey.WithValue(r.Context(), version)
 				r = r.WithContext(ctx)
+
+				w.Header().Set(HeaderCanaryVersion, version)
+				if span := opentracing.SpanFromContext(ctx); span != nil {
+					span.SetTag(spanTagCanaryVersion, version)
+				}
 			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// assign picks the version for a request, setting the cookie when the choice was random
+func (c *canaryAssigner) assign(w http.ResponseWriter, r *http.Request) string {
+	if claims, err := GetClaimsFromCtx(r.Context()); err == nil {
+		for _, userID := range claimsUserIDs(claims) {
+			if c.allowUserIDs[userID] {
+				return c.config.Version
+			}
+		}
+		for _, brandID := range claims.GetBrands() {
+			if c.allowBrandIDs[brandID] {
+				return c.config.Version
+			}
+		}
+	}
+
+	// users are sticky by their ID, the version is part of the key so each canary gets a different set of users
+	if userID := splitUserID(r.Context()); userID != "" {
+		return c.pick(inSample(c.config.Version+":"+userID, c.config.Percentage/100))
+	}
+
+	if cookie, err := r.Cookie(c.config.CookieName); err == nil {
+		switch cookie.Value {
+		case c.config.Version:
+			return c.config.Version
+		case c.stableCookieValue():
+			return c.config.StableVersion
+		}
+	}
+
+	version := c.pick(rand.Float64()*100 < c.config.Percentage)
+	cookieValue := version
+	if version != c.config.Version {
+		cookieValue = c.stableCookieValue()
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.config.CookieName,
+		Value:    cookieValue,
+		Path:     "/",
+		MaxAge:   int(c.config.CookieMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   !c.config.InsecureCookie,
+	})
+	return version
+}
+
+// stableCookieValue is the cookie value for the stable version, which needs a placeholder when it's empty
+func (c *canaryAssigner) stableCookieValue() string {
+	if c.config.StableVersion == "" {
+		return canaryCookieStable
+	}
+	return c.config.StableVersion
+}
+
+func (c *canaryAssigner) pick(canary bool) string {
+	if canary {
+		return c.config.Version
+	}
+	return c.config.StableVersion
+}
+
+// claimsUserIDs returns the IDs the user of the claims can be allowlisted by
+func claimsUserIDs(claims auth.Claim) []string {
+	var userIDs []string
+	if claims.GetUserUUID() != "" {
+		userIDs = append(userIDs, claims.GetUserUUID())
+	}
+	if claims.GetUserID() != 0 {
+		userIDs = append(userIDs, strconv.FormatInt(claims.GetUserID(), 10))
+	}
+	return userIDs
+}
+
+// splitUserID returns the ID the user is split by. The identity may not be verified, which is fine for the
+// split since anyone can ask for a version with the header anyway, but never for the allowlist
+func splitUserID(ctx context.Context) string {
+	if userIDs := GetIdentityOrAnonymous(ctx).userIDs(); len(userIDs) > 0 {
+		return userIDs[0]
+	}
+	return ""
+}
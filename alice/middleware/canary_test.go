@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_DetermineCanaryMiddlewareFuncWithConfig(t *testing.T) {
+	config := CanaryConfig{
+		Version:       "v2",
+		StableVersion: "v1",
+		AllowUserIDs:  []string{"allowed-uuid"},
+		AllowBrandIDs: []int64{42},
+	}
+
+	testCases := []struct {
+		name          string
+		config        CanaryConfig
+		header        string
+		cookie        string
+		userID        string
+		claims        *auth.Claim
+		expected      string
+		expectsCookie bool
+	}{
+		{name: "header wins", config: config, header: "v3", userID: "allowed-uuid", expected: "v3"},
+		{name: "allowed user", config: config, claims: claimsForUser("allowed-uuid"), expected: "v2"},
+		{name: "forged allowed user", config: config, userID: "allowed-uuid", expected: "v1"},
+		{name: "allowed brand", config: config, claims: claimsWithBrand(42), expected: "v2"},
+		{name: "user outside percentage", config: config, userID: "someone", expected: "v1"},
+		{name: "user inside percentage", config: withPercentage(config, 100), userID: "someone", expected: "v2"},
+		{name: "cookie", config: config, cookie: "v2", expected: "v2"},
+		{name: "unknown cookie is replaced", config: config, cookie: "v0", expected: "v1", expectsCookie: true},
+		{name: "anonymous gets a cookie", config: config, expected: "v1", expectsCookie: true},
+		{name: "insecure cookie", config: withInsecureCookie(config), expected: "v1", expectsCookie: true},
+		{name: "no canary configured", config: CanaryConfig{}, userID: "someone", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var version string
+			handler := DetermineCanaryMiddlewareFuncWithConfig(tc.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				version, _ = GetCanaryVersionFromCtx(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set(HeaderCanaryVersion, tc.header)
+			}
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CookieCanaryVersion, Value: tc.cookie})
+			}
+			ctx := setIdentity(r.Context(), Identity{UserUUID: tc.userID, Method: AuthMethodJWT})
+			if tc.claims != nil {
+				ctx = context.WithValue(ctx, contextkey.ContextKeyClaims, *tc.claims)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r.WithContext(ctx))
+
+			require.Equal(t, tc.expected, version)
+			require.Equal(t, tc.expected, w.Header().Get(HeaderCanaryVersion))
+			require.Equal(t, tc.expectsCookie, len(w.Result().Cookies()) == 1)
+			if tc.expectsCookie {
+				require.Equal(t, !tc.config.InsecureCookie, w.Result().Cookies()[0].Secure)
+			}
+		})
+	}
+}
+
+func TestUnit_CanaryStickyByUser(t *testing.T) {
+	handler := DetermineCanaryMiddlewareFuncWithConfig(CanaryConfig{Version: "v2", StableVersion: "v1", Percentage: 50})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	canary := 0
+	for i := 0; i < 200; i++ {
+		userID := time.Duration(i).String()
+		versions := map[string]bool{}
+		for j := 0; j < 3; j++ {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(setIdentity(r.Context(), Identity{UserUUID: userID, Method: AuthMethodJWT}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			versions[w.Header().Get(HeaderCanaryVersion)] = true
+		}
+		require.Len(t, versions, 1, "user %s changed versions", userID)
+		if versions["v2"] {
+			canary++
+		}
+	}
+
+	require.InDelta(t, 100, canary, 30)
+}
+
+func withPercentage(config CanaryConfig, percentage float64) CanaryConfig {
+	config.Percentage = percentage
+	return config
+}
+
+func withInsecureCookie(config CanaryConfig) CanaryConfig {
+	config.InsecureCookie = true
+	return config
+}
+
+func claimsForUser(userUUID string) *auth.Claim {
+	claims := auth.NewClaim(nil, nil, nil, time.Now().Add(time.Hour), nil, nil, []string{"user"}, 7, userUUID, 0, "", nil)
+	return &claims
+}
+
+func claimsWithBrand(brandID int64) *auth.Claim {
+	claims := auth.NewClaim([]int64{brandID}, nil, nil, time.Now().Add(time.Hour), nil, nil, []string{"user"}, 7, "user-uuid", 0, "", nil)
+	return &claims
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-metric-client/metrics"
+)
+
+const (
+	defaultClaimsCacheSize = 10000
+
+	metricClaimsCacheService = "auth.claims-cache"
+	metricClaimsCachePath    = "validate-jwt"
+	metricClaimsCache        = "claims-cache"
+	metricTagResult          = "result"
+)
+
+// ClaimsCacheConfig holds the optional behavior of a claims cache
+type ClaimsCacheConfig struct {
+	// Size is the most tokens that are cached, the least recently used are evicted first. Defaults to 10000
+	Size int
+	// MaxAge limits how long claims are cached, they are never cached past their expiration. 0 has no limit
+	MaxAge time.Duration
+	// MetricsClient reports cache hits and misses when it's set
+	MetricsClient metrics.Client
+}
+
+type claimsCacheEntry struct {
+	key       [sha256.Size]byte
+	claims    auth.Claim
+	expiresAt time.Time
+}
+
+type claimsCache struct {
+	auth.Token
+	config ClaimsCacheConfig
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+}
+
+// NewClaimsCache wraps token so the claims of tokens it validated are cached by a hash of the token, which saves
+// verifying the signature again on every request. Pass it to Auth in place of token, checks Auth does after
+// validating (like revocation) still run on every request
+func NewClaimsCache(token auth.Token, config ClaimsCacheConfig) auth.Token {
+	if config.Size <= 0 {
+		config.Size = defaultClaimsCacheSize
+	}
+	return &claimsCache{Token: token, config: config, entries: map[[sha256.Size]byte]*list.Element{}, lru: list.New()}
+}
+
+// ValidateJWT returns the cached claims for the token, or validates it and caches the claims
+func (c *claimsCache) ValidateJWT(token string) (auth.Claim, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	if claims, ok := c.get(key, now); ok {
+		c.report("hit")
+		return claims, nil
+	}
+	c.report("miss")
+
+	claims, err := c.Token.ValidateJWT(token)
+	if err != nil {
+		return claims, err
+	}
+
+	expiresAt := claims.GetExpiration()
+	if c.config.MaxAge > 0 && now.Add(c.config.MaxAge).Before(expiresAt) {
+		expiresAt = now.Add(c.config.MaxAge)
+	}
+	c.add(&claimsCacheEntry{key: key, claims: claims, expiresAt: expiresAt})
+
+	return claims, nil
+}
+
+func (c *claimsCache) get(key [sha256.Size]byte, now time.Time) (auth.Claim, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return auth.Claim{}, false
+	}
+
+	entry := element.Value.(*claimsCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return auth.Claim{}, false
+	}
+
+	c.lru.MoveToFront(element)
+	return entry.claims, true
+}
+
+func (c *claimsCache) add(entry *claimsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.config.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*claimsCacheEntry).key)
+	}
+}
+
+func (c *claimsCache) report(result string) {
+	if c.config.MetricsClient == nil {
+		return
+	}
+	c.config.MetricsClient.InternalCustom(metricClaimsCacheService, metricClaimsCachePath, metricClaimsCache, map[string]string{metricTagResult: result}, 1)
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeToken validates any token except "invalid" and empty ones, with claims that expire after expiresIn
+type fakeToken struct {
+	validations int
+	expiresIn   time.Duration
+}
+
+func (f *fakeToken) GenerateJWT(issuer string, userID int64, userUUID string, roles []string, permissions auth.Permission, duration time.Duration) (string, error) {
+	return "", nil
+}
+
+func (f *fakeToken) GenerateSystemToken(issuer string, initiatingUserID int64, duration time.Duration) (string, error) {
+	return "", nil
+}
+
+func (f *fakeToken) ValidateJWT(jwt string) (auth.Claim, error) {
+	f.validations++
+	if jwt == "invalid" || jwt == "" {
+		return auth.Claim{}, errors.New("invalid token")
+	}
+	return auth.NewClaim(nil, nil, nil, time.Now().Add(f.expiresIn), nil, nil, []string{auth.RoleUser}, 7, jwt, 0, "", nil), nil
+}
+
+func TestUnit_ClaimsCache(t *testing.T) {
+	token := &fakeToken{expiresIn: time.Hour}
+	metricsClient := &fakeMetricsClient{}
+	cache := NewClaimsCache(token, ClaimsCacheConfig{Size: 2, MetricsClient: metricsClient})
+
+	claims, err := cache.ValidateJWT("a")
+	require.NoError(t, err)
+	require.Equal(t, "a", claims.GetUserUUID())
+
+	claims, err = cache.ValidateJWT("a")
+	require.NoError(t, err)
+	require.Equal(t, "a", claims.GetUserUUID())
+	require.Equal(t, 1, token.validations)
+
+	// errors are not cached
+	_, err = cache.ValidateJWT("invalid")
+	require.Error(t, err)
+	_, err = cache.ValidateJWT("invalid")
+	require.Error(t, err)
+	require.Equal(t, 3, token.validations)
+
+	// b and c push a out of the cache
+	cache.ValidateJWT("b")
+	cache.ValidateJWT("c")
+	cache.ValidateJWT("a")
+	require.Equal(t, 6, token.validations)
+
+	require.Equal(t, map[string]string{"custom_name": "claims-cache", "result": "hit"}, metricsClient.customs[1])
+	require.Equal(t, map[string]string{"custom_name": "claims-cache", "result": "miss"}, metricsClient.customs[2])
+}
+
+func TestUnit_ClaimsCache_Expiration(t *testing.T) {
+	testCases := []struct {
+		name      string
+		expiresIn time.Duration
+		maxAge    time.Duration
+	}{
+		{name: "claims expire", expiresIn: 20 * time.Millisecond},
+		{name: "max age", expiresIn: time.Hour, maxAge: 20 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token := &fakeToken{expiresIn: tc.expiresIn}
+			cache := NewClaimsCache(token, ClaimsCacheConfig{MaxAge: tc.maxAge})
+
+			cache.ValidateJWT("a")
+			cache.ValidateJWT("a")
+			require.Equal(t, 1, token.validations)
+
+			time.Sleep(30 * time.Millisecond)
+			cache.ValidateJWT("a")
+			require.Equal(t, 2, token.validations)
+		})
+	}
+}
@@ -21,8 +21,7 @@ func GetInsecureUserIDFromContext(ctx context.Context) string {
 
 // Deprecated: Use GetLoggerFromCtx instead, which returns an error when logger is not present.
 func GetLoggerFromContext(ctx context.Context) *logrus.Entry {
-	inter := ctx.Value(contextkey.ContextKeyLogger)
-	if entry, ok := inter.(*logrus.Entry); ok {
+	if entry, ok := loggerKey.Get(ctx); ok {
 		return entry
 	}
 	return logrus.NewEntry(logrus.New()) // default to a new entry
@@ -61,9 +60,6 @@ func GetJWTFromContext(ctx context.Context) string {
 
 // getStringFromContext returns a string from the context or empty string if missing
 func getStringFromContext(ctx context.Context, key contextkey.ContextKey) string {
-	stri := ctx.Value(key)
-	if str, ok := stri.(string); ok {
-		return str
-	}
-	return ""
+	str, _ := contextkey.Of[string](key).Get(ctx)
+	return str
 }
@@ -4,25 +4,38 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"log/slog"
 
 	"github.com/promoboxx/go-auth/src/auth"
 	"github.com/promoboxx/go-service/alice/middleware/contextkey"
 	"github.com/sirupsen/logrus"
 )
 
+// typed keys for the values the middleware put in the context, they share the ContextKeys so values set with
+// context.WithValue and a ContextKey are still found
+var (
+	requestIDKey      = contextkey.Of[string](contextkey.ContextKeyRequestID)
+	insecureUserIDKey = contextkey.Of[string](contextkey.ContextKeyInsecureUserID)
+	loggerKey         = contextkey.Of[*logrus.Entry](contextkey.ContextKeyLogger)
+	slogKey           = contextkey.Of[*slog.Logger](contextkey.ContextKeySlog)
+	claimsKey         = contextkey.Of[auth.Claim](contextkey.ContextKeyClaims)
+	dbConnKey         = contextkey.Of[*sql.DB](contextkey.ContextKeyDBConn)
+	jwtKey            = contextkey.Of[string](contextkey.ContextKeyJWT)
+	canaryKey         = contextkey.Of[string](contextkey.ContextKeyCanary)
+	routeNameKey      = contextkey.Of[string](contextkey.ContextKeyRouteName)
+	identityKey       = contextkey.Of[*identityHolder](contextkey.ContextKeyIdentity)
+)
+
 // GetRequestIDFromCtx returns the requestID and an error if it's not present
 func GetRequestIDFromCtx(ctx context.Context) (string, error) {
-	requestID := ctx.Value(contextkey.ContextKeyRequestID)
-	if requestID == nil {
-		return "", errors.New("no request ID in context")
+	value, ok := requestIDKey.Get(ctx)
+	if ok {
+		return value, nil
 	}
-
-	strRequestID, ok := requestID.(string)
-	if !ok {
+	if ctx.Value(contextkey.ContextKeyRequestID) != nil {
 		return "", errors.New("invalid request ID type in context")
 	}
-
-	return strRequestID, nil
+	return "", errors.New("no request ID in context")
 }
 
 // MustGetRequestIDFromContext returns the requestID and panics if it's not present
@@ -35,21 +48,22 @@ func MustGetRequestIDFromContext(ctx context.Context) string {
 }
 
 // GetInsecureUserIDFromCtx returns the user ID and an error if it's not present
+//
+// Deprecated: Use GetIdentityFromCtx instead, which says whether the user was verified.
 func GetInsecureUserIDFromCtx(ctx context.Context) (string, error) {
-	userID := ctx.Value(contextkey.ContextKeyInsecureUserID)
-	if userID == nil {
-		return "", errors.New("no user ID in context")
+	value, ok := insecureUserIDKey.Get(ctx)
+	if ok {
+		return value, nil
 	}
-
-	strUserID, ok := userID.(string)
-	if !ok {
+	if ctx.Value(contextkey.ContextKeyInsecureUserID) != nil {
 		return "", errors.New("invalid user ID type in context")
 	}
-
-	return strUserID, nil
+	return "", errors.New("no user ID in context")
 }
 
 // MustGetInsecureUserIDFromContext returns the user ID and panics if it's not present
+//
+// Deprecated: Use GetIdentityOrAnonymous instead, which says whether the user was verified.
 func MustGetInsecureUserIDFromContext(ctx context.Context) string {
 	userID, err := GetInsecureUserIDFromCtx(ctx)
 	if err != nil {
@@ -60,17 +74,14 @@ func MustGetInsecureUserIDFromContext(ctx context.Context) string {
 
 // GetLoggerFromCtx returns a logrus entry from the context and an error if it's not present
 func GetLoggerFromCtx(ctx context.Context) (*logrus.Entry, error) {
-	logger := ctx.Value(contextkey.ContextKeyLogger)
-	if logger == nil {
-		return nil, errors.New("no logger in context")
+	value, ok := loggerKey.Get(ctx)
+	if ok {
+		return value, nil
 	}
-
-	entry, ok := logger.(*logrus.Entry)
-	if !ok {
+	if ctx.Value(contextkey.ContextKeyLogger) != nil {
 		return nil, errors.New("invalid logger type in context")
 	}
-
-	return entry, nil
+	return nil, errors.New("no logger in context")
 }
 
 // MustGetLoggerFromContext returns a logrus entry from the context and panics if it's not present
@@ -83,21 +94,38 @@ func MustGetLoggerFromContext(ctx context.Context) *logrus.Entry {
 	return logger
 }
 
-// GetClaimsFromCtx returns the auth claims from the context and an error if they are not present
-func GetClaimsFromCtx(ctx context.Context) (auth.Claim, error) {
-	claims := ctx.Value(contextkey.ContextKeyClaims)
-	if claims == nil {
-		var nilClaim auth.Claim
-		return nilClaim, errors.New("no auth claims in context")
+// GetSlogFromCtx returns a slog logger from the context and an error if it's not present
+func GetSlogFromCtx(ctx context.Context) (*slog.Logger, error) {
+	value, ok := slogKey.Get(ctx)
+	if ok {
+		return value, nil
+	}
+	if ctx.Value(contextkey.ContextKeySlog) != nil {
+		return nil, errors.New("invalid slog logger type in context")
 	}
+	return nil, errors.New("no slog logger in context")
+}
 
-	authClaims, ok := claims.(auth.Claim)
-	if !ok {
-		var nilClaim auth.Claim
-		return nilClaim, errors.New("invalid auth claims type in context")
+// MustGetSlogFromContext returns a slog logger from the context
+// If no logger is found, it returns one that writes through a default logrus entry
+func MustGetSlogFromContext(ctx context.Context) *slog.Logger {
+	logger, err := GetSlogFromCtx(ctx)
+	if err != nil {
+		return slog.New(NewLogrusHandler(logrus.NewEntry(logrus.New()))) // default to a new entry
 	}
+	return logger
+}
 
-	return authClaims, nil
+// GetClaimsFromCtx returns the auth claims from the context and an error if they are not present
+func GetClaimsFromCtx(ctx context.Context) (auth.Claim, error) {
+	value, ok := claimsKey.Get(ctx)
+	if ok {
+		return value, nil
+	}
+	if ctx.Value(contextkey.ContextKeyClaims) != nil {
+		return value, errors.New("invalid auth claims type in context")
+	}
+	return value, errors.New("no auth claims in context")
 }
 
 // MustGetClaimsFromContext returns the auth claims from the context and panics if they are not present
@@ -111,17 +139,14 @@ func MustGetClaimsFromContext(ctx context.Context) auth.Claim {
 
 // GetDBConnFromCtx returns the DB connection from the context and an error if it's not present
 func GetDBConnFromCtx(ctx context.Context) (*sql.DB, error) {
-	dbConn := ctx.Value(contextkey.ContextKeyDBConn)
-	if dbConn == nil {
-		return nil, errors.New("no DB connection in context")
+	value, ok := dbConnKey.Get(ctx)
+	if ok {
+		return value, nil
 	}
-
-	db, ok := dbConn.(*sql.DB)
-	if !ok {
+	if ctx.Value(contextkey.ContextKeyDBConn) != nil {
 		return nil, errors.New("invalid DB connection type in context")
 	}
-
-	return db, nil
+	return nil, errors.New("no DB connection in context")
 }
 
 // MustGetDBConnFromContext returns the DB connection from the context and panics if it's not present
@@ -135,23 +160,20 @@ func MustGetDBConnFromContext(ctx context.Context) *sql.DB {
 
 // GetDBFromCtx returns a database object from the context and an error if it's not present
 func GetDBFromCtx[T any](ctx context.Context, f func(*sql.DB) T) (T, error) {
-	if ctx.Value(contextkey.ContextKeyDB) == nil {
-		dbConn, err := GetDBConnFromCtx(ctx)
-		if err != nil {
-			var zero T
-			return zero, err
-		}
-		return f(dbConn), nil
-	}
-
-	db := ctx.Value(contextkey.ContextKeyDB)
-	result, ok := db.(T)
-	if !ok {
+	if db, ok := contextkey.Of[T](contextkey.ContextKeyDB).Get(ctx); ok {
+		return db, nil
+	}
+	if ctx.Value(contextkey.ContextKeyDB) != nil {
 		var zero T
 		return zero, errors.New("invalid DB type in context")
 	}
 
-	return result, nil
+	dbConn, err := GetDBConnFromCtx(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return f(dbConn), nil
 }
 
 // MustGetDBFromContext returns a database object from the context and panics if it's not present
@@ -165,17 +187,14 @@ func MustGetDBFromContext[T any](ctx context.Context, f func(*sql.DB) T) T {
 
 // GetCanaryVersionFromCtx returns the canary version and an error if it's not present
 func GetCanaryVersionFromCtx(ctx context.Context) (string, error) {
-	canary := ctx.Value(contextkey.ContextKeyCanary)
-	if canary == nil {
-		return "", errors.New("no canary version in context")
+	value, ok := canaryKey.Get(ctx)
+	if ok {
+		return value, nil
 	}
-
-	strCanary, ok := canary.(string)
-	if !ok {
+	if ctx.Value(contextkey.ContextKeyCanary) != nil {
 		return "", errors.New("invalid canary version type in context")
 	}
-
-	return strCanary, nil
+	return "", errors.New("no canary version in context")
 }
 
 // MustGetCanaryVersionFromContext returns the canary version and panics if it's not present
@@ -189,17 +208,14 @@ func MustGetCanaryVersionFromContext(ctx context.Context) string {
 
 // GetJWTFromCtx returns the JWT and an error if it's not present
 func GetJWTFromCtx(ctx context.Context) (string, error) {
-	jwt := ctx.Value(contextkey.ContextKeyJWT)
-	if jwt == nil {
-		return "", errors.New("no JWT in context")
+	value, ok := jwtKey.Get(ctx)
+	if ok {
+		return value, nil
 	}
-
-	strJWT, ok := jwt.(string)
-	if !ok {
+	if ctx.Value(contextkey.ContextKeyJWT) != nil {
 		return "", errors.New("invalid JWT type in context")
 	}
-
-	return strJWT, nil
+	return "", errors.New("no JWT in context")
 }
 
 // MustGetJWTFromContext returns the JWT and panics if it's not present
@@ -210,3 +226,15 @@ func MustGetJWTFromContext(ctx context.Context) string {
 	}
 	return jwt
 }
+
+// GetRouteNameFromCtx returns the name the route was measured with and an error if it's not present
+func GetRouteNameFromCtx(ctx context.Context) (string, error) {
+	value, ok := routeNameKey.Get(ctx)
+	if ok {
+		return value, nil
+	}
+	if ctx.Value(contextkey.ContextKeyRouteName) != nil {
+		return "", errors.New("invalid route name type in context")
+	}
+	return "", errors.New("no route name in context")
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_GetFromCtx_Errors(t *testing.T) {
+	wrongType := func(key contextkey.ContextKey) context.Context {
+		return context.WithValue(context.Background(), key, 42)
+	}
+
+	testCases := []struct {
+		name     string
+		get      func(ctx context.Context) error
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "missing request ID",
+			get:      func(ctx context.Context) error { _, err := GetRequestIDFromCtx(ctx); return err },
+			ctx:      context.Background(),
+			expected: "no request ID in context",
+		},
+		{
+			name:     "invalid request ID",
+			get:      func(ctx context.Context) error { _, err := GetRequestIDFromCtx(ctx); return err },
+			ctx:      wrongType(contextkey.ContextKeyRequestID),
+			expected: "invalid request ID type in context",
+		},
+		{
+			name:     "invalid logger",
+			get:      func(ctx context.Context) error { _, err := GetLoggerFromCtx(ctx); return err },
+			ctx:      wrongType(contextkey.ContextKeyLogger),
+			expected: "invalid logger type in context",
+		},
+		{
+			name:     "invalid claims",
+			get:      func(ctx context.Context) error { _, err := GetClaimsFromCtx(ctx); return err },
+			ctx:      wrongType(contextkey.ContextKeyClaims),
+			expected: "invalid auth claims type in context",
+		},
+		{
+			name:     "missing DB connection",
+			get:      func(ctx context.Context) error { _, err := GetDBConnFromCtx(ctx); return err },
+			ctx:      context.Background(),
+			expected: "no DB connection in context",
+		},
+		{
+			name:     "invalid JWT",
+			get:      func(ctx context.Context) error { _, err := GetJWTFromCtx(ctx); return err },
+			ctx:      wrongType(contextkey.ContextKeyJWT),
+			expected: "invalid JWT type in context",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.EqualError(t, tc.get(tc.ctx), tc.expected)
+		})
+	}
+}
@@ -1,5 +1,8 @@
 package contextkey
 
+import "fmt"
+
+// ContextKey identifies a value go-service puts in the context, services should use New for keys of their own
 type ContextKey int
 
 // context keys
@@ -13,4 +16,36 @@ const (
 	ContextKeyJWT
 	ContextKeyDB
 	ContextKeyCanary
+	ContextKeyRouteName
+	ContextKeySlog
+	ContextKeyTraceContext
+	ContextKeyFlags
+	ContextKeyAudit
+	ContextKeyIdentity
 )
+
+var contextKeyNames = map[ContextKey]string{
+	ContextKeyLogger:         "logger",
+	ContextKeyRequestID:      "request ID",
+	ContextKeyInsecureUserID: "user ID",
+	ContextKeyClaims:         "auth claims",
+	ContextKeyDBConn:         "DB connection",
+	ContextKeyProducer:       "producer",
+	ContextKeyJWT:            "JWT",
+	ContextKeyDB:             "DB",
+	ContextKeyCanary:         "canary version",
+	ContextKeyRouteName:      "route name",
+	ContextKeySlog:           "slog logger",
+	ContextKeyTraceContext:   "trace context",
+	ContextKeyFlags:          "feature flags",
+	ContextKeyAudit:          "audit recorder",
+	ContextKeyIdentity:       "identity",
+}
+
+// String returns the name of the key
+func (c ContextKey) String() string {
+	if name, ok := contextKeyNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("context key %d", int(c))
+}
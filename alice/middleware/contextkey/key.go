@@ -0,0 +1,59 @@
+package contextkey
+
+import (
+	"context"
+	"fmt"
+)
+
+// Key is a context key for values of type T. Keys made with New never collide with each other or with the
+// ContextKeys of this package, so services can declare their own:
+//
+//	var BrandKey = contextkey.New[Brand]("brand")
+//
+//	ctx = BrandKey.WithValue(ctx, brand)
+//	brand, ok := BrandKey.Get(ctx)
+type Key[T any] struct {
+	id   interface{}
+	name string
+}
+
+// keyID is unexported and compared by pointer, so a key made with New can only be matched by itself
+type keyID struct {
+	name string
+}
+
+// New returns a key that is distinct from every other key, the name is only used in errors
+func New[T any](name string) Key[T] {
+	return Key[T]{id: &keyID{name: name}, name: name}
+}
+
+// Of returns a typed key for one of the ContextKeys, it reads and writes the same value as using the ContextKey
+// with context.WithValue directly
+func Of[T any](key ContextKey) Key[T] {
+	return Key[T]{id: key, name: key.String()}
+}
+
+// WithValue returns a copy of ctx holding value
+func (k Key[T]) WithValue(ctx context.Context, value T) context.Context {
+	return context.WithValue(ctx, k.id, value)
+}
+
+// Get returns the value and true, or the zero value and false if it's not present or not a T
+func (k Key[T]) Get(ctx context.Context) (T, bool) {
+	value, ok := ctx.Value(k.id).(T)
+	return value, ok
+}
+
+// MustGet returns the value and panics if it's not present
+func (k Key[T]) MustGet(ctx context.Context) T {
+	value, ok := k.Get(ctx)
+	if !ok {
+		panic(fmt.Sprintf("no %s in context", k.name))
+	}
+	return value
+}
+
+// String returns the name of the key
+func (k Key[T]) String() string {
+	return k.name
+}
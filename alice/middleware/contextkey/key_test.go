@@ -0,0 +1,38 @@
+package contextkey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_Key(t *testing.T) {
+	brandKey := New[int64]("brand")
+	otherBrandKey := New[int64]("brand")
+	requestIDKey := Of[string](ContextKeyRequestID)
+
+	ctx := brandKey.WithValue(context.Background(), 42)
+	ctx = requestIDKey.WithValue(ctx, "request-1")
+
+	brand, ok := brandKey.Get(ctx)
+	require.True(t, ok)
+	require.Equal(t, int64(42), brand)
+	require.Equal(t, int64(42), brandKey.MustGet(ctx))
+
+	// keys with the same name don't collide
+	_, ok = otherBrandKey.Get(ctx)
+	require.False(t, ok)
+	require.PanicsWithValue(t, "no brand in context", func() { otherBrandKey.MustGet(ctx) })
+
+	// keys made from a ContextKey share the value set with the ContextKey directly
+	require.Equal(t, "request-1", ctx.Value(ContextKeyRequestID))
+	ctx = context.WithValue(ctx, ContextKeyCanary, "v2")
+	canary, ok := Of[string](ContextKeyCanary).Get(ctx)
+	require.True(t, ok)
+	require.Equal(t, "v2", canary)
+
+	// a value of the wrong type isn't returned
+	_, ok = Of[int](ContextKeyCanary).Get(ctx)
+	require.False(t, ok)
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/promoboxx/go-auth/src/auth"
+)
+
+// AuthMethod is how the caller authenticated
+type AuthMethod string
+
+// auth methods
+const (
+	AuthMethodAnonymous   AuthMethod = "anonymous"
+	AuthMethodJWT         AuthMethod = "jwt"
+	AuthMethodSystemToken AuthMethod = "system_token"
+	AuthMethodAPIKey      AuthMethod = "api_key"
+)
+
+// Identity is who made the request. The UserIDInjector puts an unverified identity read from the JWT in the
+// context, and Auth or APIKeyAuth replace it with a verified one once the credentials are checked
+type Identity struct {
+	UserID   int64      `json:"user_id,omitempty"`
+	UserUUID string     `json:"user_uuid,omitempty"`
+	APIKeyID string     `json:"api_key_id,omitempty"`
+	Method   AuthMethod `json:"method"`
+	// Verified is true once the credentials were checked, unverified identities must not be used for authorization
+	Verified bool `json:"verified"`
+}
+
+// ID returns the user UUID, or the user ID, or the API key ID, whichever is set first
+func (i Identity) ID() string {
+	switch {
+	case i.UserUUID != "":
+		return i.UserUUID
+	case i.UserID != 0:
+		return strconv.FormatInt(i.UserID, 10)
+	default:
+		return i.APIKeyID
+	}
+}
+
+// userIDs returns the user UUID and ID the identity can be matched by
+func (i Identity) userIDs() []string {
+	var ids []string
+	if i.UserUUID != "" {
+		ids = append(ids, i.UserUUID)
+	}
+	if i.UserID != 0 {
+		ids = append(ids, strconv.FormatInt(i.UserID, 10))
+	}
+	return ids
+}
+
+// Key identifies the caller across requests, like for rate limiting, it's empty for anonymous callers
+func (i Identity) Key() string {
+	id := i.ID()
+	if id == "" {
+		return ""
+	}
+	return string(i.Method) + ":" + id
+}
+
+// identityHolder lets Auth replace the identity in place, so middleware that wrap Auth (the logger and timer)
+// see the verified identity once the handler returns
+type identityHolder struct {
+	mu       sync.RWMutex
+	identity Identity
+}
+
+// GetIdentityFromCtx returns the identity and an error if it's not present
+func GetIdentityFromCtx(ctx context.Context) (Identity, error) {
+	holder, ok := identityKey.Get(ctx)
+	if !ok {
+		return Identity{}, errors.New("no identity in context")
+	}
+
+	holder.mu.RLock()
+	defer holder.mu.RUnlock()
+	return holder.identity, nil
+}
+
+// MustGetIdentityFromContext returns the identity and panics if it's not present
+func MustGetIdentityFromContext(ctx context.Context) Identity {
+	identity, err := GetIdentityFromCtx(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return identity
+}
+
+// GetIdentityOrAnonymous returns the identity, or an anonymous one if it's not present
+func GetIdentityOrAnonymous(ctx context.Context) Identity {
+	identity, err := GetIdentityFromCtx(ctx)
+	if err != nil {
+		return Identity{Method: AuthMethodAnonymous}
+	}
+	return identity
+}
+
+// setIdentity replaces the identity already in the context, or adds it when there isn't one
+func setIdentity(ctx context.Context, identity Identity) context.Context {
+	tagSpanWithIdentity(ctx, identity)
+
+	if holder, ok := identityKey.Get(ctx); ok {
+		holder.mu.Lock()
+		holder.identity = identity
+		holder.mu.Unlock()
+		return ctx
+	}
+
+	return identityKey.WithValue(ctx, &identityHolder{identity: identity})
+}
+
+// identityFromClaims returns the verified identity of validated claims
+func identityFromClaims(claims auth.Claim) Identity {
+	method := AuthMethodJWT
+	if claims.IsSystem() {
+		method = AuthMethodSystemToken
+	}
+	return Identity{UserID: claims.GetUserID(), UserUUID: claims.GetUserUUID(), Method: method, Verified: true}
+}
+
+// unverifiedClaims are the claims the UserIDInjector reads without validating the token, sub is a number
+// in tokens from go-auth but a string from other issuers
+type unverifiedClaims struct {
+	Subject     interface{} `json:"sub"`
+	SubjectUUID string      `json:"sub_uuid"`
+	Roles       []string    `json:"roles"`
+}
+
+// unverifiedIdentity returns the identity in a JWT payload that hasn't been validated
+func unverifiedIdentity(payload []byte) Identity {
+	identity := Identity{Method: AuthMethodJWT}
+
+	// use numbers so large user IDs don't lose precision as a float64
+	var claims unverifiedClaims
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return identity
+	}
+
+	identity.UserUUID = claims.SubjectUUID
+	switch sub := claims.Subject.(type) {
+	case json.Number:
+		identity.UserID, _ = sub.Int64()
+	case string:
+		if identity.UserUUID == "" {
+			identity.UserUUID = sub
+		}
+	}
+	for _, role := range claims.Roles {
+		if strings.EqualFold(role, auth.RoleSystem) {
+			identity.Method = AuthMethodSystemToken
+		}
+	}
+
+	return identity
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type base64Decoder struct{}
+
+func (base64Decoder) DecodeSegment(seg string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(seg)
+}
+
+func unsignedJWT(payload string) string {
+	return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestUnit_UserIDInjector_Identity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		value    string
+		expected Identity
+	}{
+		{
+			name:     "anonymous",
+			expected: Identity{Method: AuthMethodAnonymous},
+		},
+		{
+			name:     "numeric sub",
+			header:   "Authorization",
+			value:    "Bearer " + unsignedJWT(`{"sub": 9007199254740993, "sub_uuid": "user-uuid"}`),
+			expected: Identity{UserID: 9007199254740993, UserUUID: "user-uuid", Method: AuthMethodJWT},
+		},
+		{
+			name:     "string sub",
+			header:   "Authorization",
+			value:    unsignedJWT(`{"sub": "user-uuid"}`),
+			expected: Identity{UserUUID: "user-uuid", Method: AuthMethodJWT},
+		},
+		{
+			name:     "system token",
+			header:   "Authorization",
+			value:    unsignedJWT(`{"sub": 0, "roles": ["system"]}`),
+			expected: Identity{Method: AuthMethodSystemToken},
+		},
+		{
+			name:     "api key",
+			header:   HeaderAPIKey,
+			value:    "key",
+			expected: Identity{Method: AuthMethodAPIKey},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var identity Identity
+			handler := NewUserIDInjector(base64Decoder{}).Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity = GetIdentityOrAnonymous(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			require.Equal(t, tc.expected, identity)
+		})
+	}
+}
+
+func TestUnit_Auth_VerifiesIdentity(t *testing.T) {
+	jwt := unsignedJWT(`{"sub": 7}`)
+
+	testCases := []struct {
+		name     string
+		jwt      string
+		expected Identity
+	}{
+		{
+			name:     "valid",
+			jwt:      jwt,
+			expected: Identity{UserID: 7, UserUUID: jwt, Method: AuthMethodJWT, Verified: true},
+		},
+		{
+			name:     "invalid",
+			jwt:      "invalid",
+			expected: Identity{Method: AuthMethodAnonymous},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the identity is read outside of Auth once the handler returns, like the logger does
+			var identity Identity
+			handler := NewUserIDInjector(base64Decoder{}).Inject(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Auth(&fakeToken{expiresIn: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+				identity = GetIdentityOrAnonymous(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", tc.jwt)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			require.Equal(t, tc.expected, identity)
+		})
+	}
+}
+
+func TestUnit_Identity_Key(t *testing.T) {
+	testCases := []struct {
+		identity Identity
+		expected string
+	}{
+		{identity: Identity{Method: AuthMethodAnonymous}, expected: ""},
+		{identity: Identity{UserID: 7, Method: AuthMethodJWT}, expected: "jwt:7"},
+		{identity: Identity{UserID: 7, UserUUID: "user-uuid", Method: AuthMethodJWT}, expected: "jwt:user-uuid"},
+		{identity: Identity{APIKeyID: "key-1", Method: AuthMethodAPIKey}, expected: "api_key:key-1"},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, tc.identity.Key())
+	}
+}
+
+func TestUnit_GetIdentity_Missing(t *testing.T) {
+	ctx := httptest.NewRequest(http.MethodGet, "/", nil).Context()
+
+	require.Equal(t, Identity{Method: AuthMethodAnonymous}, GetIdentityOrAnonymous(ctx))
+	require.Panics(t, func() { MustGetIdentityFromContext(ctx) })
+}
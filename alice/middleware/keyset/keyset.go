@@ -0,0 +1,223 @@
+package keyset
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// headerKeyID is the JWT header that names the key the token was signed with
+const headerKeyID = "kid"
+
+// ErrCannotSign is returned when generating a token from a KeySet without a Signer
+var ErrCannotSign = errors.New("key set has no signer")
+
+var _ auth.Token = &KeySet{}
+
+// Config holds the optional behavior of a KeySet
+type Config struct {
+	// ReloadInterval is how often the keys are loaded from the source, 0 only loads them once
+	ReloadInterval time.Duration
+	// RetainRemoved keeps accepting keys that were removed from the source for this long, so tokens
+	// signed before a rotation are valid until they expire
+	RetainRemoved time.Duration
+	// Signer generates tokens for GenerateJWT and GenerateSystemToken, they return ErrCannotSign when it's nil
+	Signer auth.Token
+}
+
+type key struct {
+	publicKey *rsa.PublicKey
+	// removedAt is set when the key is no longer in the source
+	removedAt time.Time
+}
+
+// KeySet is an auth.Token that validates JWTs with the key named by their kid header, so the signing key can
+// be rotated without redeploying every service. Tokens without a kid are checked against every key.
+// It can be passed to Auth and AuthOptional in place of a single key token
+type KeySet struct {
+	source Source
+	config Config
+	logger *logrus.Entry
+
+	mu   sync.RWMutex
+	keys map[string]key
+}
+
+// New loads the keys from the source and reloads them every config.ReloadInterval until ctx is done.
+// Reload errors are logged and the keys already loaded are kept, a default logger is used when logger is nil
+func New(ctx context.Context, source Source, config Config, logger *logrus.Entry) (*KeySet, error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.New())
+	}
+	k := &KeySet{source: source, config: config, logger: logger, keys: map[string]key{}}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	if config.ReloadInterval > 0 {
+		go k.watch(ctx)
+	}
+
+	return k, nil
+}
+
+func (k *KeySet) watch(ctx context.Context) {
+	ticker := time.NewTicker(k.config.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(); err != nil {
+				k.logger.WithError(err).Error("Could not reload JWT keys")
+			}
+		}
+	}
+}
+
+// Reload loads the keys from the source, keys that were removed are kept for config.RetainRemoved
+func (k *KeySet) Reload() error {
+	loaded, err := k.source.Load()
+	if err != nil {
+		return err
+	}
+	if len(loaded) == 0 {
+		return errors.New("no JWT keys were loaded")
+	}
+
+	now := time.Now()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := make(map[string]key, len(loaded))
+	for id, publicKey := range loaded {
+		keys[id] = key{publicKey: publicKey}
+	}
+	for id, old := range k.keys {
+		if _, ok := keys[id]; ok {
+			continue
+		}
+		if old.removedAt.IsZero() {
+			old.removedAt = now
+		}
+		if now.Sub(old.removedAt) < k.config.RetainRemoved {
+			keys[id] = old
+		}
+	}
+	k.keys = keys
+
+	return nil
+}
+
+// KeyIDs returns the IDs of the keys that are accepted
+func (k *KeySet) KeyIDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ValidateJWT validates the token with the key named by its kid header and returns its claims
+func (k *KeySet) ValidateJWT(token string) (auth.Claim, error) {
+	token = strings.TrimPrefix(token, "Bearer ")
+
+	// read the kid before verifying so we know which key to verify with
+	unverified, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.MapClaims{})
+	if err != nil {
+		return auth.Claim{}, err
+	}
+	keyID, _ := unverified.Header[headerKeyID].(string)
+
+	k.mu.RLock()
+	var candidates []*rsa.PublicKey
+	if keyID != "" {
+		if key, ok := k.keys[keyID]; ok {
+			candidates = append(candidates, key.publicKey)
+		}
+	} else {
+		for _, key := range k.keys {
+			candidates = append(candidates, key.publicKey)
+		}
+	}
+	k.mu.RUnlock()
+
+	if len(candidates) == 0 {
+		return auth.Claim{}, fmt.Errorf("unknown key id %q", keyID)
+	}
+
+	for _, publicKey := range candidates {
+		var claims auth.JWTClaim
+		claims, err = validate(token, publicKey)
+		if err == nil {
+			return auth.NewClaim(
+				claims.Permissions.Brands,
+				claims.Permissions.BrandsUUIDs,
+				claims.Permissions.Divisions,
+				claims.GetExpiration(),
+				claims.Permissions.RetailerAccounts,
+				claims.Permissions.Retailers,
+				claims.Roles,
+				claims.Subject,
+				claims.SubjectUUID,
+				claims.InitiatingUser,
+				claims.InitiatingUserUUID,
+				claims.Permissions.BusinessIDs,
+			), nil
+		}
+	}
+
+	return auth.Claim{}, err
+}
+
+// GenerateJWT generates a token with the Signer
+func (k *KeySet) GenerateJWT(issuer string, userID int64, userUUID string, roles []string, permissions auth.Permission, duration time.Duration) (string, error) {
+	if k.config.Signer == nil {
+		return "", ErrCannotSign
+	}
+	return k.config.Signer.GenerateJWT(issuer, userID, userUUID, roles, permissions, duration)
+}
+
+// GenerateSystemToken generates a system token with the Signer
+func (k *KeySet) GenerateSystemToken(issuer string, initiatingUserID int64, duration time.Duration) (string, error) {
+	if k.config.Signer == nil {
+		return "", ErrCannotSign
+	}
+	return k.config.Signer.GenerateSystemToken(issuer, initiatingUserID, duration)
+}
+
+// validate checks the signature and claims of the token with the key
+func validate(token string, publicKey *rsa.PublicKey) (auth.JWTClaim, error) {
+	var claims auth.JWTClaim
+	t, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		// validate the alg is RSA
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", t.Header["alg"])
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return claims, err
+	}
+	if !t.Valid {
+		return claims, errors.New("Token not valid")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,143 @@
+package keyset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_KeySet_PEMDir(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeKey(t, dir, "2024-01")
+	newKey := writeKey(t, dir, "2024-02")
+	strangerKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	keys, err := New(context.Background(), NewPEMDirSource(dir), Config{RetainRemoved: time.Hour}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	require.Equal(t, []string{"2024-01", "2024-02"}, keys.KeyIDs())
+
+	testCases := []struct {
+		name    string
+		token   string
+		isError bool
+	}{
+		{name: "new key", token: sign(t, newKey, "2024-02", time.Hour)},
+		{name: "old key", token: sign(t, oldKey, "2024-01", time.Hour)},
+		{name: "bearer prefix", token: "Bearer " + sign(t, newKey, "2024-02", time.Hour)},
+		{name: "no kid", token: sign(t, oldKey, "", time.Hour)},
+		{name: "wrong kid", token: sign(t, oldKey, "2024-02", time.Hour), isError: true},
+		{name: "unknown kid", token: sign(t, newKey, "2023-12", time.Hour), isError: true},
+		{name: "unknown key", token: sign(t, strangerKey, "", time.Hour), isError: true},
+		{name: "expired", token: sign(t, newKey, "2024-02", -time.Minute), isError: true},
+		{name: "garbage", token: "not.a.jwt", isError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := keys.ValidateJWT(tc.token)
+			if tc.isError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, int64(7), claims.GetUserID())
+			require.Equal(t, "user-uuid", claims.GetUserUUID())
+			require.Equal(t, []int64{42}, claims.GetBrands())
+		})
+	}
+
+	// the old key is retained after it's removed from the source
+	require.NoError(t, os.Remove(filepath.Join(dir, "2024-01.pem")))
+	require.NoError(t, keys.Reload())
+	_, err = keys.ValidateJWT(sign(t, oldKey, "2024-01", time.Hour))
+	require.NoError(t, err)
+
+	keys.config.RetainRemoved = 0
+	require.NoError(t, keys.Reload())
+	require.Equal(t, []string{"2024-02"}, keys.KeyIDs())
+	_, err = keys.ValidateJWT(sign(t, oldKey, "2024-01", time.Hour))
+	require.Error(t, err)
+
+	_, err = keys.GenerateJWT("test", 1, "uuid", nil, auth.Permission{}, time.Hour)
+	require.Equal(t, ErrCannotSign, err)
+}
+
+func TestUnit_KeySet_JWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": "signing", "use": "sig", "n": encodeInt(key.N), "e": encodeInt(big.NewInt(int64(key.E)))},
+				{"kty": "RSA", "kid": "encryption", "use": "enc", "n": encodeInt(key.N), "e": encodeInt(big.NewInt(int64(key.E)))},
+				{"kty": "EC", "kid": "elliptic"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	keys, err := New(context.Background(), NewJWKSSource(server.URL, nil), Config{}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+	require.Equal(t, []string{"signing"}, keys.KeyIDs())
+
+	claims, err := keys.ValidateJWT(sign(t, key, "signing", time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(7), claims.GetUserID())
+}
+
+func writeKey(t *testing.T, dir, keyID string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, keyID+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	return key
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, keyID string, duration time.Duration) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS512, auth.JWTClaim{
+		ExpiresAt:   time.Now().Add(duration).Unix(),
+		Subject:     7,
+		SubjectUUID: "user-uuid",
+		Roles:       []string{auth.RoleUser},
+		Permissions: auth.Permission{Brands: []int64{42}},
+	})
+	if keyID != "" {
+		token.Header[headerKeyID] = keyID
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestUnit_NewJWKSSource_DefaultTimeout(t *testing.T) {
+	source := NewJWKSSource("https://keys.example.com/jwks.json", nil).(*jwksSource)
+
+	require.NotSame(t, http.DefaultClient, source.client)
+	require.Equal(t, defaultJWKSTimeout, source.client.Timeout)
+}
@@ -0,0 +1,132 @@
+package keyset
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Source loads the current verification keys by key ID
+type Source interface {
+	Load() (map[string]*rsa.PublicKey, error)
+}
+
+type pemDirSource struct {
+	dir string
+}
+
+// NewPEMDirSource loads every .pem file in dir as a public key (or certificate), the key ID is the file name
+// without the extension
+func NewPEMDirSource(dir string) Source {
+	return &pemDirSource{dir: dir}
+}
+
+func (s *pemDirSource) Load() (map[string]*rsa.PublicKey, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key %s: %v", path, err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key %s: %v", path, err)
+		}
+		keys[strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))] = key
+	}
+
+	return keys, nil
+}
+
+// defaultJWKSTimeout bounds fetching a JWKS url when no client is given, so a hung key server can't stall refreshes
+const defaultJWKSTimeout = 10 * time.Second
+
+type jwksSource struct {
+	location string
+	client   *http.Client
+}
+
+// jwks is a JSON Web Key Set document, only the fields of RSA keys are read
+type jwks struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+	} `json:"keys"`
+}
+
+// NewJWKSSource loads the RSA signing keys from a JWKS document, location is either an http(s) url or a
+// file path. client is used for urls, a client with a 10 second timeout is used when it's nil
+func NewJWKSSource(location string, client *http.Client) Source {
+	if client == nil {
+		client = &http.Client{Timeout: defaultJWKSTimeout}
+	}
+	return &jwksSource{location: location, client: client}
+}
+
+func (s *jwksSource) Load() (map[string]*rsa.PublicKey, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var doc jwks
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("could not parse JWKS: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %s: %v", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %s: %v", k.KeyID, err)
+		}
+
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	return keys, nil
+}
+
+func (s *jwksSource) read() ([]byte, error) {
+	if !strings.HasPrefix(s.location, "http://") && !strings.HasPrefix(s.location, "https://") {
+		return os.ReadFile(s.location)
+	}
+
+	resp, err := s.client.Get(s.location)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch JWKS: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package middleware
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ListenForSignals steps the log level up on SIGUSR1 and down on SIGUSR2 until ctx is done.
+// If revertAfter is greater than 0 each change goes back to the previous level after that much time
+func (c *LevelController) ListenForSignals(ctx context.Context, revertAfter time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if sig == syscall.SIGUSR1 {
+					c.StepUp(revertAfter)
+				} else {
+					c.StepDown(revertAfter)
+				}
+				c.logger.Printf("Log level changed to %s by %s", c.GetLevel(), sig)
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package middleware
+
+import (
+	"context"
+	"time"
+)
+
+// ListenForSignals is a no-op on windows since SIGUSR1 and SIGUSR2 do not exist
+func (c *LevelController) ListenForSignals(ctx context.Context, revertAfter time.Duration) {}
@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-service/service"
+	"github.com/sirupsen/logrus"
+)
+
+// LevelController allows the level of a logrus logger to be changed while the service is running
+// and can turn on debug logging for specific users or request IDs
+type LevelController struct {
+	logger      *logrus.Logger
+	debugLogger *logrus.Logger
+
+	mu            sync.Mutex
+	baseLevel     logrus.Level
+	revertAt      time.Time
+	revertTimer   *time.Timer
+	debugUsers    map[string]time.Time
+	debugRequests map[string]time.Time
+
+	// revertGeneration changes with every SetLevel so timers it replaced can tell
+	revertGeneration uint64
+}
+
+// levelState is the admin route representation of the controller
+type levelState struct {
+	Level           string     `json:"level"`
+	BaseLevel       string     `json:"base_level"`
+	RevertAt        *time.Time `json:"revert_at,omitempty"`
+	DebugUserIDs    []string   `json:"debug_user_ids"`
+	DebugRequestIDs []string   `json:"debug_request_ids"`
+}
+
+// levelUpdate is the body accepted by the admin route
+type levelUpdate struct {
+	Level              string   `json:"level"`
+	RevertAfterMinutes int      `json:"revert_after_minutes"`
+	DebugUserIDs       []string `json:"debug_user_ids"`
+	DebugRequestIDs    []string `json:"debug_request_ids"`
+	DebugMinutes       int      `json:"debug_minutes"`
+}
+
+// defaultDebugDuration is how long user and request debugging lasts when no duration is given
+const defaultDebugDuration = 15 * time.Minute
+
+// NewLevelController creates a controller for the logger, usually the Logger of the entry from GetDefaultLogger
+func NewLevelController(logger *logrus.Logger) *LevelController {
+	debugLogger := &logrus.Logger{
+		Out:          logger.Out,
+		Hooks:        logger.Hooks,
+		Formatter:    logger.Formatter,
+		ReportCaller: logger.ReportCaller,
+		Level:        logrus.DebugLevel,
+		ExitFunc:     logger.ExitFunc,
+	}
+
+	return &LevelController{
+		logger:        logger,
+		debugLogger:   debugLogger,
+		baseLevel:     logger.GetLevel(),
+		debugUsers:    map[string]time.Time{},
+		debugRequests: map[string]time.Time{},
+	}
+}
+
+// GetLevel returns the current level of the logger
+func (c *LevelController) GetLevel() logrus.Level {
+	return c.logger.GetLevel()
+}
+
+// SetLevel changes the level of the logger. If revertAfter is greater than 0 the logger will go back to its
+// previous level after that much time, otherwise the new level becomes permanent
+func (c *LevelController) SetLevel(level logrus.Level, revertAfter time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.revertTimer != nil {
+		c.revertTimer.Stop()
+		c.revertTimer = nil
+		c.revertAt = time.Time{}
+	}
+	c.revertGeneration++
+
+	c.logger.SetLevel(level)
+	if revertAfter <= 0 {
+		c.baseLevel = level
+		return
+	}
+
+	generation := c.revertGeneration
+	c.revertAt = time.Now().Add(revertAfter)
+	c.revertTimer = time.AfterFunc(revertAfter, func() { c.revert(generation) })
+}
+
+// StepUp makes the logger one level more verbose
+func (c *LevelController) StepUp(revertAfter time.Duration) {
+	level := c.GetLevel()
+	if level < logrus.TraceLevel {
+		level++
+	}
+	c.SetLevel(level, revertAfter)
+}
+
+// StepDown makes the logger one level less verbose
+func (c *LevelController) StepDown(revertAfter time.Duration) {
+	level := c.GetLevel()
+	if level > logrus.PanicLevel {
+		level--
+	}
+	c.SetLevel(level, revertAfter)
+}
+
+// DebugUser turns on debug logging for requests made by the user for the duration
+func (c *LevelController) DebugUser(userID string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debugUsers[userID] = time.Now().Add(d)
+}
+
+// DebugRequest turns on debug logging for the request ID for the duration
+func (c *LevelController) DebugRequest(requestID string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debugRequests[requestID] = time.Now().Add(d)
+}
+
+// EntryFor returns entry, switched over to a debug logger if the request is being debugged
+// and the logger is not already that verbose
+func (c *LevelController) EntryFor(r *http.Request, entry *logrus.Entry) *logrus.Entry {
+	if c.GetLevel() >= logrus.DebugLevel || !c.isDebugging(r) {
+		return entry
+	}
+
+	return logrus.NewEntry(c.debugLogger).WithFields(entry.Data)
+}
+
+// ServeHTTP is the admin route for the controller. GET returns the current state and PUT accepts a level and/or
+// users and request IDs to debug. It requires admin claims so it should be placed behind Auth
+func (c *LevelController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	AdminOnly(http.HandlerFunc(c.serveAdmin)).ServeHTTP(w, r)
+}
+
+func (c *LevelController) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var update levelUpdate
+		err := json.NewDecoder(r.Body).Decode(&update)
+		if err != nil {
+			service.WriteProblem(w, "Could not decode request body", "INVALID_BODY", http.StatusBadRequest, err)
+			return
+		}
+
+		if update.Level != "" {
+			level, err := logrus.ParseLevel(update.Level)
+			if err != nil {
+				service.WriteProblem(w, "Invalid log level", "INVALID_LEVEL", http.StatusBadRequest, err)
+				return
+			}
+			c.SetLevel(level, time.Duration(update.RevertAfterMinutes)*time.Minute)
+		}
+
+		debugDuration := defaultDebugDuration
+		if update.DebugMinutes > 0 {
+			debugDuration = time.Duration(update.DebugMinutes) * time.Minute
+		}
+		for _, userID := range update.DebugUserIDs {
+			c.DebugUser(userID, debugDuration)
+		}
+		for _, requestID := range update.DebugRequestIDs {
+			c.DebugRequest(requestID, debugDuration)
+		}
+	default:
+		service.WriteProblem(w, "Method not allowed", "ERROR_METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	service.WriteJSONResponse(w, http.StatusOK, c.state())
+}
+
+// revert puts the logger back to its base level once a temporary level expires. A timer that
+// fired while SetLevel was replacing it has an old generation and does nothing
+func (c *LevelController) revert(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.revertGeneration {
+		return
+	}
+
+	c.logger.SetLevel(c.baseLevel)
+	c.revertTimer = nil
+	c.revertAt = time.Time{}
+}
+
+// isDebugging returns true if the user or request ID of the request is being debugged, and
+// cleans up any targets that have expired
+func (c *LevelController) isDebugging(r *http.Request) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.debugUsers) == 0 && len(c.debugRequests) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	requestID, _ := GetRequestIDFromCtx(r.Context())
+	if isActiveTarget(c.debugRequests, requestID, now) {
+		return true
+	}
+	// the identity isn't verified yet when the logger is set up, that's fine for picking a log level
+	for _, userID := range GetIdentityOrAnonymous(r.Context()).userIDs() {
+		if isActiveTarget(c.debugUsers, userID, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *LevelController) state() levelState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	s := levelState{
+		Level:           c.logger.GetLevel().String(),
+		BaseLevel:       c.baseLevel.String(),
+		DebugUserIDs:    activeTargets(c.debugUsers, now),
+		DebugRequestIDs: activeTargets(c.debugRequests, now),
+	}
+	if !c.revertAt.IsZero() {
+		revertAt := c.revertAt
+		s.RevertAt = &revertAt
+	}
+
+	return s
+}
+
+// isActiveTarget returns true if the key is in targets and has not expired, expired keys are removed
+func isActiveTarget(targets map[string]time.Time, key string, now time.Time) bool {
+	if key == "" {
+		return false
+	}
+
+	expiresAt, ok := targets[key]
+	if !ok {
+		return false
+	}
+	if now.After(expiresAt) {
+		delete(targets, key)
+		return false
+	}
+
+	return true
+}
+
+// activeTargets lists the keys that have not expired, expired keys are removed
+func activeTargets(targets map[string]time.Time, now time.Time) []string {
+	result := make([]string, 0, len(targets))
+	for key := range targets {
+		if isActiveTarget(targets, key, now) {
+			result = append(result, key)
+		}
+	}
+
+	return result
+}
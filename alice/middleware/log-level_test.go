@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_LevelController_SetLevel(t *testing.T) {
+	l := logrus.New()
+	l.SetLevel(logrus.InfoLevel)
+	c := NewLevelController(l)
+
+	c.SetLevel(logrus.DebugLevel, 20*time.Millisecond)
+	require.Equal(t, logrus.DebugLevel, c.GetLevel())
+	require.Eventually(t, func() bool { return c.GetLevel() == logrus.InfoLevel }, time.Second, 5*time.Millisecond)
+
+	c.StepDown(0)
+	require.Equal(t, logrus.WarnLevel, c.GetLevel())
+	c.StepUp(0)
+	c.StepUp(0)
+	require.Equal(t, logrus.DebugLevel, c.GetLevel())
+}
+
+func TestUnit_LevelController_StaleRevert(t *testing.T) {
+	l := logrus.New()
+	l.SetLevel(logrus.InfoLevel)
+	c := NewLevelController(l)
+
+	c.SetLevel(logrus.DebugLevel, time.Hour)
+	c.mu.Lock()
+	stale := c.revertGeneration
+	c.mu.Unlock()
+
+	// the replaced timer already fired and was waiting on the lock when SetLevel ran
+	c.SetLevel(logrus.TraceLevel, time.Hour)
+	c.revert(stale)
+	require.Equal(t, logrus.TraceLevel, c.GetLevel())
+
+	c.mu.Lock()
+	current := c.revertGeneration
+	c.mu.Unlock()
+	c.revert(current)
+	require.Equal(t, logrus.InfoLevel, c.GetLevel())
+
+	// a revert that fires right away still sees its own generation
+	c.SetLevel(logrus.DebugLevel, time.Nanosecond)
+	require.Eventually(t, func() bool { return c.GetLevel() == logrus.InfoLevel }, time.Second, time.Millisecond)
+}
+
+func TestUnit_LevelController_EntryFor(t *testing.T) {
+	l := logrus.New()
+	l.SetLevel(logrus.InfoLevel)
+	c := NewLevelController(l)
+	c.DebugUser("42", time.Minute)
+
+	newRequest := func(userID string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		return r.WithContext(setIdentity(r.Context(), Identity{UserUUID: userID, Method: AuthMethodJWT}))
+	}
+
+	entry := logrus.NewEntry(l).WithField("service", "test")
+
+	debugEntry := c.EntryFor(newRequest("42"), entry)
+	require.Equal(t, logrus.DebugLevel, debugEntry.Logger.GetLevel())
+	require.Equal(t, "test", debugEntry.Data["service"])
+
+	require.Equal(t, entry, c.EntryFor(newRequest("7"), entry))
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderForceLog can be sent with an authenticated request to make sure it is always logged, useful when debugging
+	HeaderForceLog = "X-Force-Log"
+
+	// sampleBuckets is the resolution of the sample rate, a rate of 0.0001 is the smallest that can be honored
+	sampleBuckets = 10000
+)
+
+// LogSampler decides whether a finished request should be logged
+type LogSampler interface {
+	ShouldLog(r *http.Request, route string, statusCode int, duration time.Duration) bool
+}
+
+// SamplingConfig configures which requests get logged by a sampled logger.
+// Client and server errors and slow requests are always logged, successful requests
+// are sampled at the rate for their route (or DefaultRate when the route has none)
+type SamplingConfig struct {
+	// DefaultRate is the fraction (0-1) of successful requests to log
+	DefaultRate float64
+	// RouteRates overrides DefaultRate for the route names given to Measure
+	RouteRates map[string]float64
+	// SlowThreshold will always log requests that take at least this long, 0 disables it
+	SlowThreshold time.Duration
+	// ForceHeader is the header that forces a request to be logged when set to true, defaults to HeaderForceLog.
+	// It's only honored once the request's identity is verified so anonymous clients can't skip sampling
+	ForceHeader string
+	// ForceUserIDs will always log requests for these user IDs or UUIDs
+	ForceUserIDs []string
+}
+
+type logSampler struct {
+	config       SamplingConfig
+	forceUserIDs map[string]bool
+}
+
+// NewLogSampler creates a LogSampler from the config
+func NewLogSampler(config SamplingConfig) LogSampler {
+	if config.ForceHeader == "" {
+		config.ForceHeader = HeaderForceLog
+	}
+
+	forceUserIDs := make(map[string]bool, len(config.ForceUserIDs))
+	for _, userID := range config.ForceUserIDs {
+		forceUserIDs[userID] = true
+	}
+
+	return &logSampler{config: config, forceUserIDs: forceUserIDs}
+}
+
+// ShouldLog returns true if the request is an error, slow, forced or falls within the sample rate of its route
+func (s *logSampler) ShouldLog(r *http.Request, route string, statusCode int, duration time.Duration) bool {
+	if statusCode >= http.StatusBadRequest {
+		return true
+	}
+
+	if s.config.SlowThreshold > 0 && duration >= s.config.SlowThreshold {
+		return true
+	}
+
+	if strings.EqualFold(r.Header.Get(s.config.ForceHeader), "true") && GetIdentityOrAnonymous(r.Context()).Verified {
+		return true
+	}
+
+	// the identity may not be verified, that's fine for deciding what to log
+	for _, userID := range GetIdentityOrAnonymous(r.Context()).userIDs() {
+		if s.forceUserIDs[userID] {
+			return true
+		}
+	}
+
+	rate, ok := s.config.RouteRates[route]
+	if !ok {
+		rate = s.config.DefaultRate
+	}
+
+	requestID, _ := GetRequestIDFromCtx(r.Context())
+	return SampleRequestID(requestID, rate)
+}
+
+// SampleRequestID returns true if the request ID falls within the rate. The decision only depends on
+// the request ID, so every service that uses it will make the same decision for the same request
+func SampleRequestID(requestID string, rate float64) bool {
+	return inSample(requestID, rate)
+}
+
+// inSample hashes key and returns true if it falls within the rate, the same key always gets the same answer
+func inSample(key string, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()%sampleBuckets < uint64(rate*sampleBuckets)
+}
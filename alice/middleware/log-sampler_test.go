@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_LogSampler(t *testing.T) {
+	newRequest := func(requestID, userID string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/things", nil)
+		ctx := context.WithValue(r.Context(), contextkey.ContextKeyRequestID, requestID)
+		ctx = setIdentity(ctx, Identity{UserUUID: userID, Method: AuthMethodJWT})
+		return r.WithContext(ctx)
+	}
+
+	tests := map[string]struct {
+		config   SamplingConfig
+		request  func() *http.Request
+		route    string
+		status   int
+		duration time.Duration
+		expected bool
+	}{
+		"server errors are always logged": {
+			request:  func() *http.Request { return newRequest("abc", "") },
+			status:   http.StatusInternalServerError,
+			expected: true,
+		},
+		"client errors are always logged": {
+			request:  func() *http.Request { return newRequest("abc", "") },
+			status:   http.StatusNotFound,
+			expected: true,
+		},
+		"slow requests are always logged": {
+			config:   SamplingConfig{SlowThreshold: time.Second},
+			request:  func() *http.Request { return newRequest("abc", "") },
+			status:   http.StatusOK,
+			duration: 2 * time.Second,
+			expected: true,
+		},
+		"force header logs a verified request": {
+			request: func() *http.Request {
+				r := newRequest("abc", "")
+				r.Header.Set(HeaderForceLog, "true")
+				return r.WithContext(setIdentity(r.Context(), Identity{UserUUID: "123", Method: AuthMethodJWT, Verified: true}))
+			},
+			status:   http.StatusOK,
+			expected: true,
+		},
+		"force header is ignored without a verified identity": {
+			request: func() *http.Request {
+				r := newRequest("abc", "")
+				r.Header.Set(HeaderForceLog, "true")
+				return r
+			},
+			status:   http.StatusOK,
+			expected: false,
+		},
+		"forced user ID logs the request": {
+			config:   SamplingConfig{ForceUserIDs: []string{"123"}},
+			request:  func() *http.Request { return newRequest("abc", "123") },
+			status:   http.StatusOK,
+			expected: true,
+		},
+		"success is dropped with a zero rate": {
+			request:  func() *http.Request { return newRequest("abc", "") },
+			status:   http.StatusOK,
+			expected: false,
+		},
+		"route rate overrides the default rate": {
+			config:   SamplingConfig{DefaultRate: 0, RouteRates: map[string]float64{"get things": 1}},
+			request:  func() *http.Request { return newRequest("abc", "") },
+			route:    "get things",
+			status:   http.StatusOK,
+			expected: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sampler := NewLogSampler(tc.config)
+			require.Equal(t, tc.expected, sampler.ShouldLog(tc.request(), tc.route, tc.status, tc.duration))
+		})
+	}
+}
+
+func TestUnit_SampleRequestID(t *testing.T) {
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		requestID := fmt.Sprintf("request-%d", i)
+		first := SampleRequestID(requestID, 0.25)
+		require.Equal(t, first, SampleRequestID(requestID, 0.25), "decision should be consistent")
+		if first {
+			sampled++
+		}
+	}
+
+	require.InDelta(t, 2500, sampled, 300)
+}
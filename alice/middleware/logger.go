@@ -1,25 +1,32 @@
 package middleware
 
 import (
-	"context"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/promoboxx/go-service/alice/middleware/lrw"
 
 	"github.com/promoboxx/go-glitch/glitch"
-	"github.com/promoboxx/go-service/alice/middleware/contextkey"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	logFieldRequestID   = "request_id"
 	logFieldUserID      = "user_id"
+	logFieldUserUUID    = "user_uuid"
 	logFieldMethod      = "method"
 	logFieldStatusCode  = "status_code"
 	logFieldPath        = "path"
 	logFieldError       = "error"
 	logFieldTraceID     = "dd.trace_id"
+	logFieldSpanID      = "dd.span_id"
 	logFieldQueryParams = "query_params"
+	logFieldDurationMS  = "duration_ms"
+	logFieldCanary      = "canary_version"
+	logFieldAuthMethod  = "auth_method"
+	logFieldVerified    = "user_verified"
 )
 
 // Logger injects a logger into the context
@@ -27,14 +34,35 @@ type Logger interface {
 	Log(h http.Handler) http.Handler
 }
 
+// LoggerConfig holds the optional behavior of a logrus Logger
+type LoggerConfig struct {
+	// LogRequests logs each finished request
+	LogRequests bool
+	// Sampler limits which finished requests are logged, nil logs all of them
+	Sampler LogSampler
+	// Levels allows debug logging to be turned on for specific users or request IDs
+	Levels *LevelController
+}
+
 type logger struct {
-	entry       *logrus.Entry
-	logRequests bool
+	entry  *logrus.Entry
+	config LoggerConfig
 }
 
 // NewLogrusLogger allows you to setup a base entry to use for logging
 func NewLogrusLogger(baseEntry *logrus.Entry, logRequests bool) Logger {
-	return &logger{entry: baseEntry, logRequests: logRequests}
+	return NewLogrusLoggerWithConfig(baseEntry, LoggerConfig{LogRequests: logRequests})
+}
+
+// NewSampledLogrusLogger is like NewLogrusLogger with logRequests set, but only logs the
+// finished requests that the sampler allows
+func NewSampledLogrusLogger(baseEntry *logrus.Entry, sampler LogSampler) Logger {
+	return NewLogrusLoggerWithConfig(baseEntry, LoggerConfig{LogRequests: true, Sampler: sampler})
+}
+
+// NewLogrusLoggerWithConfig allows you to setup a base entry to use for logging along with any optional behavior
+func NewLogrusLoggerWithConfig(baseEntry *logrus.Entry, config LoggerConfig) Logger {
+	return &logger{entry: baseEntry, config: config}
 }
 
 // Log is the middleware for injecting a logger into the context that has
@@ -43,47 +71,88 @@ func (l *logger) Log(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// base fields that get added to each log entry
 		fields := logrus.Fields{
-			logFieldUserID:      GetInsecureUserIDFromContext(r.Context()),
+			logFieldRequestID:   GetRequestIDFromContext(r.Context()),
 			logFieldMethod:      r.Method,
 			logFieldPath:        r.URL.Path,
 			logFieldQueryParams: r.URL.Query(),
-			// this header comes from the data dog span information that gets injected
-			// every request from the headers
-			logFieldTraceID: r.Header.Get("X-Datadog-Trace-ID"),
 		}
 
-		entry := l.entry.WithFields(fields)
+		addIdentityFields(fields, GetIdentityOrAnonymous(r.Context()))
 
-		// add logger to the context
-		ctx := context.WithValue(r.Context(), contextkey.ContextKeyLogger, entry)
-		r = r.WithContext(ctx)
+		if canary, err := GetCanaryVersionFromCtx(r.Context()); err == nil && canary != "" {
+			fields[logFieldCanary] = canary
+		}
 
-		h.ServeHTTP(w, r)
+		// use the span started by the timer, falling back to the data dog header in case
+		// the timer is not tracing
+		if traceID, spanID, ok := GetSpanIDsFromCtx(r.Context()); ok {
+			fields[logFieldTraceID] = strconv.FormatUint(traceID, 10)
+			fields[logFieldSpanID] = strconv.FormatUint(spanID, 10)
+		} else {
+			fields[logFieldTraceID] = r.Header.Get("X-Datadog-Trace-ID")
+		}
 
-		responseFields := fields
+		baseEntry := l.entry
+		if l.config.Levels != nil {
+			baseEntry = l.config.Levels.EntryFor(r, baseEntry)
+		}
+		entry := baseEntry.WithFields(fields)
 
-		if loggingResponseWriter, ok := w.(*lrw.LoggingResponseWriter); ok {
-			responseFields[logFieldStatusCode] = loggingResponseWriter.StatusCode
+		// add logger to the context, along with a slog logger that writes through it
+		ctx := loggerKey.WithValue(r.Context(), entry)
+		ctx = slogKey.WithValue(ctx, slog.New(NewLogrusHandler(entry)))
+		r = r.WithContext(ctx)
+
+		// wrap the writer here too so the status is known without a timer, Wrap reuses the timer's writer
+		loggingResponseWriter := lrw.Wrap(w)
 
-			if loggingResponseWriter.InnerError != nil {
-				fields[logFieldError] = loggingResponseWriter.InnerError
+		start := time.Now()
+		h.ServeHTTP(loggingResponseWriter, r)
+		duration := time.Since(start)
 
-				if dataErr, ok := loggingResponseWriter.InnerError.(glitch.DataError); ok {
-					for k, v := range dataErr.GetFields() {
-						fields[k] = v
-					}
+		responseFields := fields
+		responseFields[logFieldDurationMS] = duration.Milliseconds()
+		// Auth verifies the identity inside the handler, so log the one the request finished with
+		addIdentityFields(responseFields, GetIdentityOrAnonymous(r.Context()))
+		statusCode := loggingResponseWriter.StatusCode
+		responseFields[logFieldStatusCode] = statusCode
+
+		if loggingResponseWriter.InnerError != nil {
+			fields[logFieldError] = loggingResponseWriter.InnerError
+
+			if dataErr, ok := loggingResponseWriter.InnerError.(glitch.DataError); ok {
+				for k, v := range dataErr.GetFields() {
+					fields[k] = v
 				}
 			}
+		}
 
-			for fieldName, message := range loggingResponseWriter.ExtraFields {
-				fields[fieldName] = message
-			}
+		for fieldName, message := range loggingResponseWriter.ExtraFields {
+			fields[fieldName] = message
 		}
 
-		responseEntry := l.entry.WithFields(responseFields)
+		responseEntry := baseEntry.WithFields(responseFields)
 
-		if l.logRequests {
+		if l.config.LogRequests && l.shouldLog(r, statusCode, duration) {
 			responseEntry.Printf("Finished request")
 		}
 	})
 }
+
+// shouldLog checks the sampler, if there is one, to see if the finished request should be logged
+func (l *logger) shouldLog(r *http.Request, statusCode int, duration time.Duration) bool {
+	if l.config.Sampler == nil {
+		return true
+	}
+
+	route, _ := GetRouteNameFromCtx(r.Context())
+	return l.config.Sampler.ShouldLog(r, route, statusCode, duration)
+}
+
+// addIdentityFields adds who made the request to the fields
+func addIdentityFields(fields logrus.Fields, identity Identity) {
+	fields[logFieldUserID] = identity.UserID
+	fields[logFieldUserUUID] = identity.UserUUID
+	fields[logFieldAuthMethod] = string(identity.Method)
+	fields[logFieldVerified] = identity.Verified
+}
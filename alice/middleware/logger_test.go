@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_Logger_StatusWithoutTimer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		status    int
+		expectLog bool
+	}{
+		{name: "success is sampled out", status: http.StatusOK, expectLog: false},
+		{name: "error is always logged", status: http.StatusInternalServerError, expectLog: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := logrus.New()
+			l.SetOutput(&buf)
+
+			// nothing wraps the writer before the logger, like with NewNullTimer
+			logger := NewLogrusLoggerWithConfig(logrus.NewEntry(l), LoggerConfig{LogRequests: true, Sampler: NewLogSampler(SamplingConfig{DefaultRate: 0})})
+			handler := logger.Log(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			require.Equal(t, tc.expectLog, bytes.Contains(buf.Bytes(), []byte("Finished request")))
+		})
+	}
+}
@@ -7,9 +7,10 @@ import (
 
 type LoggingResponseWriter struct {
 	http.ResponseWriter
-	StatusCode  int
-	InnerError  error
-	ExtraFields map[string]string
+	StatusCode   int
+	InnerError   error
+	ExtraFields  map[string]string
+	BytesWritten int
 }
 
 type InvalidFieldError struct {
@@ -22,10 +23,26 @@ func (l *LoggingResponseWriter) WriteHeader(code int) {
 	l.ResponseWriter.WriteHeader(code)
 }
 
+// Write counts the bytes written to the response
+func (l *LoggingResponseWriter) Write(b []byte) (int, error) {
+	n, err := l.ResponseWriter.Write(b)
+	l.BytesWritten += n
+	return n, err
+}
+
 func NewLoggingResponseWriter(rw http.ResponseWriter) *LoggingResponseWriter {
 	return &LoggingResponseWriter{ResponseWriter: rw, StatusCode: http.StatusOK, InnerError: nil, ExtraFields: map[string]string{}}
 }
 
+// Wrap returns rw if it is already a LoggingResponseWriter, otherwise it wraps rw in a new one. This lets
+// several middleware share the status code and error of a response
+func Wrap(rw http.ResponseWriter) *LoggingResponseWriter {
+	if lrw, ok := rw.(*LoggingResponseWriter); ok {
+		return lrw
+	}
+	return NewLoggingResponseWriter(rw)
+}
+
 // AddLogField will attempt to add the field to the logs that will emitted for each request, it will fail if it attempts to override another field
 func (l *LoggingResponseWriter) AddLogField(name string, value string) error {
 	if _, ok := l.ExtraFields[name]; !ok {
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/promoboxx/go-glitch/glitch"
+	"github.com/promoboxx/go-metric-client/metrics"
+	"github.com/promoboxx/go-service/alice/middleware/lrw"
+)
+
+const (
+	metricDirectionInbound = "inbound"
+	metricCustomRequest    = "request"
+	metricTagStatusClass   = "status_class"
+	metricTagCanary        = "canary"
+)
+
+type metricsTimer struct {
+	serviceName   string
+	metricsClient metrics.Client
+}
+
+// NewMetricsTimer creates a Timer that reports the rate, errors and duration of each measured route through
+// the metrics client. Each request is reported as an inbound ExternalRate and ExternalDuration for the route,
+// 5xx responses as an ExternalError, and an ExternalCustom "request" count tagged with the status class and
+// canary version since the rate and duration metrics can't carry extra tags
+func NewMetricsTimer(serviceName string, metricsClient metrics.Client) Timer {
+	return &metricsTimer{serviceName: serviceName, metricsClient: metricsClient}
+}
+
+func (m *metricsTimer) Time(name string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// make the response writer a logging response writer so we can access the status code
+			loggingResponseWriter := lrw.Wrap(w)
+
+			start := time.Now()
+			h.ServeHTTP(loggingResponseWriter, r)
+			duration := time.Since(start)
+
+			status := loggingResponseWriter.StatusCode
+			m.metricsClient.ExternalRate(metricDirectionInbound, m.serviceName, name, 1)
+			m.metricsClient.ExternalDuration(metricDirectionInbound, m.serviceName, name, duration)
+			m.metricsClient.ExternalCustom(metricDirectionInbound, m.serviceName, name, metricCustomRequest, map[string]string{
+				metricTagStatusClass: StatusClass(status),
+				metricTagCanary:      MustGetCanaryVersionFromContext(r.Context()),
+			}, 1)
+
+			if status >= http.StatusInternalServerError {
+				m.metricsClient.ExternalError(metricDirectionInbound, m.serviceName, name, errorCode(loggingResponseWriter), http.StatusText(status), 1)
+			}
+		})
+	}
+}
+
+// StatusClass returns the class of the status code, like 2xx or 5xx
+func StatusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// errorCode returns the code of the error written to the response, or UNKNOWN if there isn't one
+func errorCode(w *lrw.LoggingResponseWriter) string {
+	if dataErr, ok := w.InnerError.(glitch.DataError); ok {
+		return dataErr.Code()
+	}
+	if code, ok := w.ExtraFields["error_code"]; ok {
+		return code
+	}
+	return glitch.UnknownCode
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/service"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMetricsClient records the metrics reported through it
+type fakeMetricsClient struct {
+	mu        sync.Mutex
+	rates     []string
+	durations []string
+	errors    []string
+	customs   []map[string]string
+}
+
+func (f *fakeMetricsClient) BackgroundRate(sessionID, jobName string, params map[string]string, value int64) error {
+	return nil
+}
+
+func (f *fakeMetricsClient) BackgroundError(sessionID, jobName string, params map[string]string, code, message string, value int64) error {
+	return nil
+}
+
+func (f *fakeMetricsClient) BackgroundDuration(sessionID, jobName string, params map[string]string, value time.Duration) error {
+	return nil
+}
+
+func (f *fakeMetricsClient) BackgroundCustom(sessionID string, jobName string, customName string, params, other map[string]string, value int64) error {
+	return nil
+}
+
+func (f *fakeMetricsClient) ExternalRate(direction, externalService, path string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rates = append(f.rates, path)
+	return nil
+}
+
+func (f *fakeMetricsClient) ExternalError(direction, externalService, path, code, message string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors = append(f.errors, code)
+	return nil
+}
+
+func (f *fakeMetricsClient) ExternalDuration(direction, externalService, path string, value time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.durations = append(f.durations, path)
+	return nil
+}
+
+func (f *fakeMetricsClient) ExternalCustom(direction, externalService, path, customName string, other map[string]string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	custom := map[string]string{"custom_name": customName}
+	for k, v := range other {
+		custom[k] = v
+	}
+	f.customs = append(f.customs, custom)
+	return nil
+}
+
+func (f *fakeMetricsClient) InternalCustom(originatingService, path, customName string, other map[string]string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	custom := map[string]string{"custom_name": customName}
+	for k, v := range other {
+		custom[k] = v
+	}
+	f.customs = append(f.customs, custom)
+	return nil
+}
+
+func (f *fakeMetricsClient) StartSpanWithContext(ctx context.Context, name string) (opentracing.Span, context.Context) {
+	return opentracing.StartSpanFromContext(ctx, name)
+}
+
+func TestUnit_MetricsTimer(t *testing.T) {
+	metricsClient := &fakeMetricsClient{}
+	timer := NewCompositeTimer(NewNullTimer(), NewMetricsTimer("test-service", metricsClient))
+
+	handler := timer.Time("get thing")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		service.WriteProblem(w, "broken", "BROKEN", http.StatusInternalServerError, errors.New("broken"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/thing", nil)
+	r = r.WithContext(context.WithValue(r.Context(), contextkey.ContextKeyCanary, "v2"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Equal(t, []string{"get thing"}, metricsClient.rates)
+	require.Equal(t, []string{"get thing"}, metricsClient.durations)
+	require.Equal(t, []string{"BROKEN"}, metricsClient.errors)
+	require.Equal(t, []map[string]string{{"custom_name": "request", "status_class": "5xx", "canary": "v2"}}, metricsClient.customs)
+}
@@ -0,0 +1,308 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/justinas/alice"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/service"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	logFieldPolicyRoute  = "policy_route"
+	logFieldPolicyShadow = "policy_shadow"
+)
+
+// Policy is the access a route requires. Claims must have one of the Roles (when there are any)
+// and pass one of the Checks (when there are any)
+type Policy struct {
+	// Public routes don't need claims
+	Public bool `yaml:"public" json:"public"`
+	// Roles the claims need one of
+	Roles []string `yaml:"roles" json:"roles,omitempty"`
+	// Checks the claims need to pass one of
+	Checks []PolicyCheck `yaml:"checks" json:"checks,omitempty"`
+	// CheckFuncs are added to Checks, for checks that can't be declared in yaml
+	CheckFuncs []CheckFunc `yaml:"-" json:"-"`
+	// Shadow logs what the policy would do without blocking the request
+	Shadow bool `yaml:"shadow" json:"shadow"`
+}
+
+// PolicyCheck declares an auth.Check. The ID it checks comes from the path parameter in Param, or Value when
+// there is no Param. Type is one of user, user_uuid, role, brand, brand_uuid, retailer, retailer_account,
+// division or business_id
+type PolicyCheck struct {
+	Type  string `yaml:"type" json:"type"`
+	Param string `yaml:"param" json:"param,omitempty"`
+	Value string `yaml:"value" json:"value,omitempty"`
+}
+
+// policyCheckTypes builds the check for each PolicyCheck type from its ID
+var policyCheckTypes = map[string]func(id string) (auth.Check, error){
+	"user":             int64Check(func(id int64) auth.Check { return auth.CheckUser{UserID: id} }),
+	"user_uuid":        func(id string) (auth.Check, error) { return auth.CheckUserUUID{UserUUID: id}, nil },
+	"role":             func(id string) (auth.Check, error) { return auth.CheckRole{Role: id}, nil },
+	"brand":            int64Check(func(id int64) auth.Check { return auth.CheckBrand{BrandID: id} }),
+	"brand_uuid":       func(id string) (auth.Check, error) { return auth.CheckBrandUUID{BrandUUID: id}, nil },
+	"retailer":         int64Check(func(id int64) auth.Check { return auth.CheckRetailer{RetailerID: id} }),
+	"retailer_account": int64Check(func(id int64) auth.Check { return auth.CheckRetailerAccount{RetailerAccountID: id} }),
+	"division":         int64Check(func(id int64) auth.Check { return auth.CheckDivision{DivisionID: id} }),
+	"business_id":      func(id string) (auth.Check, error) { return auth.CheckBusinessID{BusinessID: id}, nil },
+}
+
+func int64Check(check func(id int64) auth.Check) func(id string) (auth.Check, error) {
+	return func(id string) (auth.Check, error) {
+		i, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return check(i), nil
+	}
+}
+
+// CheckFunc builds the CheckFunc for the declared check
+func (pc PolicyCheck) CheckFunc() (CheckFunc, error) {
+	build, ok := policyCheckTypes[pc.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown check type %q", pc.Type)
+	}
+
+	if pc.Param != "" {
+		return StringParam(pc.Param, func(value string) auth.Check {
+			check, err := build(value)
+			if err != nil {
+				return nil
+			}
+			return check
+		}), nil
+	}
+
+	check, err := build(pc.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s check: %v", pc.Value, pc.Type, err)
+	}
+	return Check(check), nil
+}
+
+// PolicyFile is the layout of a yaml policy file:
+//
+//	shadow: false
+//	routes:
+//	  get brand:
+//	    roles: [admin, brand]
+//	    checks:
+//	      - type: brand
+//	        param: brand_id
+type PolicyFile struct {
+	// Shadow puts every policy in shadow mode
+	Shadow bool `yaml:"shadow"`
+	// DenyUnlisted denies requests to routes without a policy
+	DenyUnlisted bool              `yaml:"deny_unlisted"`
+	Routes       map[string]Policy `yaml:"routes"`
+}
+
+// PolicySetConfig holds the optional behavior of a PolicySet
+type PolicySetConfig struct {
+	// Shadow puts every policy in shadow mode, including the denial of unlisted routes
+	Shadow bool
+	// DenyUnlisted denies requests to routes without a policy instead of letting them through
+	DenyUnlisted bool
+}
+
+// PolicySet enforces the policies for the routes given to Measure
+type PolicySet struct {
+	shadow       bool
+	denyUnlisted bool
+	policies     map[string]Policy
+	roles        map[string][]CheckFunc
+	checks       map[string][]CheckFunc
+
+	mu       sync.Mutex
+	measured map[string]bool
+	// unlistedLogged holds the routes without a policy that were already logged
+	unlistedLogged sync.Map
+}
+
+// PolicyReport lists the routes that are measured without a policy, and the policies for routes
+// that were never measured, which are usually typos
+type PolicyReport struct {
+	RoutesWithoutPolicy  []string `json:"routes_without_policy"`
+	PoliciesWithoutRoute []string `json:"policies_without_route"`
+}
+
+// NewPolicySet creates a PolicySet from policies keyed by the route names given to Measure. When shadow is set
+// every policy is in shadow mode
+func NewPolicySet(policies map[string]Policy, shadow bool) (*PolicySet, error) {
+	return NewPolicySetWithConfig(policies, PolicySetConfig{Shadow: shadow})
+}
+
+// NewPolicySetWithConfig creates a PolicySet from policies keyed by the route names given to Measure with the
+// optional behavior in config
+func NewPolicySetWithConfig(policies map[string]Policy, config PolicySetConfig) (*PolicySet, error) {
+	p := &PolicySet{
+		shadow:       config.Shadow,
+		denyUnlisted: config.DenyUnlisted,
+		policies:     policies,
+		roles:        make(map[string][]CheckFunc, len(policies)),
+		checks:       make(map[string][]CheckFunc, len(policies)),
+		measured:     map[string]bool{},
+	}
+
+	for route, policy := range policies {
+		for _, role := range policy.Roles {
+			p.roles[route] = append(p.roles[route], Check(auth.CheckRole{Role: role}))
+		}
+		for _, policyCheck := range policy.Checks {
+			checkFunc, err := policyCheck.CheckFunc()
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy for %s: %v", route, err)
+			}
+			p.checks[route] = append(p.checks[route], checkFunc)
+		}
+		p.checks[route] = append(p.checks[route], policy.CheckFuncs...)
+	}
+
+	return p, nil
+}
+
+// LoadPolicySet creates a PolicySet from a yaml PolicyFile
+func LoadPolicySet(path string) (*PolicySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read policy file: %v", err)
+	}
+
+	var file PolicyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse policy file: %v", err)
+	}
+
+	return NewPolicySetWithConfig(file.Routes, PolicySetConfig{Shadow: file.Shadow, DenyUnlisted: file.DenyUnlisted})
+}
+
+// Enforce returns the middleware that enforces the route's policy. Routes without a policy show up in the Report
+// and are denied with DenyUnlisted, otherwise they are let through and logged the first time. It needs the claims so Auth
+// (or AuthOptional for routes with public policies) must run first
+func (p *PolicySet) Enforce(route string) alice.Constructor {
+	p.mu.Lock()
+	p.measured[route] = true
+	p.mu.Unlock()
+
+	policy, ok := p.policies[route]
+	if !ok {
+		return p.enforceUnlisted(route)
+	}
+
+	shadow := p.shadow || policy.Shadow
+	roles := p.roles[route]
+	checks := p.checks[route]
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy.Public {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			logger := MustGetLoggerFromContext(r.Context()).WithField(logFieldPolicyRoute, route).WithField(logFieldPolicyShadow, shadow)
+
+			claims, err := GetClaimsFromCtx(r.Context())
+			if err != nil {
+				logger.Printf("Policy denied request without claims")
+				if !shadow {
+					service.WriteProblem(w, "Could not find claims", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			var failed []string
+			if len(roles) > 0 {
+				failed = append(failed, failedChecks(r, claims, roles, false)...)
+			}
+			if len(checks) > 0 {
+				failed = append(failed, failedChecks(r, claims, checks, false)...)
+			}
+
+			if len(failed) == 0 {
+				if shadow {
+					logger.Debugf("Policy allowed request")
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			logger.WithField(logFieldFailedChecks, strings.Join(failed, ", ")).Printf("Policy denied request")
+			if !shadow {
+				service.WriteProblem(w, "You do not have permission to do this", "FORBIDDEN", http.StatusForbidden, errors.New("policy check failed"))
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// enforceUnlisted handles a route without a policy
+func (p *PolicySet) enforceUnlisted(route string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := MustGetLoggerFromContext(r.Context()).WithField(logFieldPolicyRoute, route).WithField(logFieldPolicyShadow, p.shadow)
+
+			if !p.denyUnlisted {
+				// the Report lists every route without a policy, the log is only a heads up
+				if _, logged := p.unlistedLogged.LoadOrStore(route, true); !logged {
+					logger.Printf("Route has no policy")
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			logger.Printf("Policy denied request to a route without a policy")
+			if !p.shadow {
+				service.WriteProblem(w, "You do not have permission to do this", "FORBIDDEN", http.StatusForbidden, errors.New("route has no policy"))
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Report lists the measured routes without a policy and the policies without a measured route
+func (p *PolicySet) Report() PolicyReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	report := PolicyReport{RoutesWithoutPolicy: []string{}, PoliciesWithoutRoute: []string{}}
+	for route := range p.measured {
+		if _, ok := p.policies[route]; !ok {
+			report.RoutesWithoutPolicy = append(report.RoutesWithoutPolicy, route)
+		}
+	}
+	for route := range p.policies {
+		if !p.measured[route] {
+			report.PoliciesWithoutRoute = append(report.PoliciesWithoutRoute, route)
+		}
+	}
+	sort.Strings(report.RoutesWithoutPolicy)
+	sort.Strings(report.PoliciesWithoutRoute)
+
+	return report
+}
+
+// ServeHTTP writes the Report as json. It requires admin claims so it should be placed behind Auth
+func (p *PolicySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	AdminOnly(http.HandlerFunc(p.serveReport)).ServeHTTP(w, r)
+}
+
+func (p *PolicySet) serveReport(w http.ResponseWriter, r *http.Request) {
+	service.WriteJSONResponse(w, http.StatusOK, p.Report())
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/husobee/vestigo"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicyFile = `
+routes:
+  get brand:
+    roles: [admin, user]
+    checks:
+      - type: brand
+        param: brand_id
+  get brand shadow:
+    shadow: true
+    checks:
+      - type: brand
+        param: brand_id
+  get status:
+    public: true
+  typo route:
+    roles: [admin]
+`
+
+func TestUnit_PolicySet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testPolicyFile), 0o600))
+
+	policies, err := LoadPolicySet(path)
+	require.NoError(t, err)
+
+	claims := auth.NewClaim([]int64{42}, nil, nil, time.Now().Add(time.Hour), nil, nil, []string{auth.RoleUser}, 7, "user-uuid", 0, "", nil)
+
+	testCases := []struct {
+		name     string
+		route    string
+		claims   *auth.Claim
+		brandID  string
+		expected int
+		logged   string
+	}{
+		{name: "allowed", route: "get brand", claims: &claims, brandID: "42", expected: http.StatusOK},
+		{name: "denied", route: "get brand", claims: &claims, brandID: "5", expected: http.StatusForbidden, logged: "Policy denied request"},
+		{name: "no claims", route: "get brand", brandID: "42", expected: http.StatusUnauthorized},
+		{name: "shadow denied", route: "get brand shadow", claims: &claims, brandID: "5", expected: http.StatusOK, logged: "auth.CheckBrand{BrandID:5}"},
+		{name: "shadow no claims", route: "get brand shadow", brandID: "5", expected: http.StatusOK, logged: "Policy denied request without claims"},
+		{name: "public", route: "get status", expected: http.StatusOK},
+		{name: "no policy", route: "get user", expected: http.StatusOK, logged: "Route has no policy"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			l := logrus.New()
+			l.Out = &logs
+
+			r := httptest.NewRequest(http.MethodGet, "/brand/"+tc.brandID, nil)
+			vestigo.AddParam(r, "brand_id", tc.brandID)
+			ctx := context.WithValue(r.Context(), contextkey.ContextKeyLogger, logrus.NewEntry(l))
+			if tc.claims != nil {
+				ctx = context.WithValue(ctx, contextkey.ContextKeyClaims, *tc.claims)
+			}
+
+			w := httptest.NewRecorder()
+			policies.Enforce(tc.route)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r.WithContext(ctx))
+
+			require.Equal(t, tc.expected, w.Code)
+			if tc.logged != "" {
+				require.Contains(t, logs.String(), tc.logged)
+			}
+		})
+	}
+
+	require.Equal(t, PolicyReport{
+		RoutesWithoutPolicy:  []string{"get user"},
+		PoliciesWithoutRoute: []string{"typo route"},
+	}, policies.Report())
+}
+
+func TestUnit_PolicySet_UnlistedLoggedOnce(t *testing.T) {
+	var logs bytes.Buffer
+	l := logrus.New()
+	l.Out = &logs
+
+	policies, err := NewPolicySet(nil, false)
+	require.NoError(t, err)
+	handler := policies.Enforce("get user")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/user", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextkey.ContextKeyLogger, logrus.NewEntry(l))))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	require.Equal(t, 1, strings.Count(logs.String(), "Route has no policy"))
+}
+
+func TestUnit_PolicySet_DenyUnlisted(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   PolicySetConfig
+		expected int
+	}{
+		{name: "denied", config: PolicySetConfig{DenyUnlisted: true}, expected: http.StatusForbidden},
+		{name: "shadow", config: PolicySetConfig{DenyUnlisted: true, Shadow: true}, expected: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			l := logrus.New()
+			l.Out = &logs
+
+			policies, err := NewPolicySetWithConfig(map[string]Policy{"get status": {Public: true}}, tc.config)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, "/user", nil)
+			ctx := context.WithValue(r.Context(), contextkey.ContextKeyLogger, logrus.NewEntry(l))
+
+			w := httptest.NewRecorder()
+			policies.Enforce("get user")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r.WithContext(ctx))
+
+			require.Equal(t, tc.expected, w.Code)
+			require.Contains(t, logs.String(), "Policy denied request to a route without a policy")
+		})
+	}
+}
+
+func TestUnit_PolicySet_ServeHTTPRequiresAdmin(t *testing.T) {
+	policies, err := NewPolicySet(nil, false)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	policies.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/policies", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUnit_NewPolicySet_InvalidCheck(t *testing.T) {
+	_, err := NewPolicySet(map[string]Policy{"get brand": {Checks: []PolicyCheck{{Type: "planet", Value: "1"}}}}, false)
+	require.Error(t, err)
+
+	_, err = NewPolicySet(map[string]Policy{"get brand": {Checks: []PolicyCheck{{Type: "brand", Value: "abc"}}}}, false)
+	require.Error(t, err)
+
+	policies, err := NewPolicySet(map[string]Policy{"get brand": {Checks: []PolicyCheck{{Type: "brand", Value: "42"}}}}, false)
+	require.NoError(t, err)
+	require.NotNil(t, policies)
+}
@@ -1,30 +1,61 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 
-	"github.com/google/uuid"
-	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/uuid"
 )
 
 const (
 	HeaderRequestID = "x-request-id"
+
+	// maxRequestIDLength is the longest request ID that will be accepted from a client
+	maxRequestIDLength = 128
 )
 
-// RequestID adds a request id to the context, if available it will use the one in the x-request-id header
+// RequestID adds a request id to the context and the response headers. It uses the x-request-id header
+// when it is valid, otherwise the trace ID of the traceparent header, and otherwise generates a new
+// time sortable id
 func RequestID(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		//check header for existing request id
 		rID := r.Header.Get(HeaderRequestID)
+		if !IsValidRequestID(rID) {
+			rID = ""
+			if tp, ok := ParseTraceParent(r.Header.Get(HeaderTraceParent)); ok {
+				rID = tp.TraceIDHex()
+			}
+		}
 		if len(rID) == 0 {
 			//generate id
-			rID = uuid.New().String()
+			rID = uuid.NewV7()
 		}
 
+		w.Header().Set(HeaderRequestID, rID)
+
 		// add rID to the context
-		ctx := context.WithValue(r.Context(), contextkey.ContextKeyRequestID, rID)
+		ctx := requestIDKey.WithValue(r.Context(), rID)
 		r = r.WithContext(ctx)
 		h.ServeHTTP(w, r)
 	})
 }
+
+// IsValidRequestID returns true if the id is short enough and only uses letters, digits and . _ : -
+// so it can't be used to inject anything into logs or headers
+func IsValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
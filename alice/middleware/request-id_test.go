@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/promoboxx/go-service/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_RequestID(t *testing.T) {
+	tests := map[string]struct {
+		headers  map[string]string
+		validate func(t *testing.T, requestID string)
+	}{
+		"valid header is used": {
+			headers: map[string]string{HeaderRequestID: "abc-123"},
+			validate: func(t *testing.T, requestID string) {
+				require.Equal(t, "abc-123", requestID)
+			},
+		},
+		"invalid header is replaced": {
+			headers: map[string]string{HeaderRequestID: "abc\n{\"level\":\"error\"}"},
+			validate: func(t *testing.T, requestID string) {
+				require.True(t, uuid.IsValid(requestID))
+			},
+		},
+		"long header is replaced": {
+			headers: map[string]string{HeaderRequestID: strings.Repeat("a", maxRequestIDLength+1)},
+			validate: func(t *testing.T, requestID string) {
+				require.True(t, uuid.IsValid(requestID))
+			},
+		},
+		"traceparent is used when there is no request id": {
+			headers: map[string]string{HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+			validate: func(t *testing.T, requestID string) {
+				require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestID)
+			},
+		},
+		"invalid traceparent is ignored": {
+			headers: map[string]string{HeaderTraceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+			validate: func(t *testing.T, requestID string) {
+				require.True(t, uuid.IsValid(requestID))
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			var requestID string
+			RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestID = MustGetRequestIDFromContext(r.Context())
+			})).ServeHTTP(w, r)
+
+			tc.validate(t, requestID)
+			require.Equal(t, requestID, w.Header().Get(HeaderRequestID))
+		})
+	}
+}
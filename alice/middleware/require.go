@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/husobee/vestigo"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/service"
+)
+
+const logFieldFailedChecks = "failed_checks"
+
+// CheckFunc builds the check for a request, so it can use the resource IDs in the path
+type CheckFunc func(r *http.Request) auth.Check
+
+// Require only lets requests through when the claims pass at least one of the checks, it should be placed after Auth.
+// Requests without claims get a 401 and requests that fail get a 403, the failed checks are logged but not sent to the client
+func Require(checks ...CheckFunc) func(http.Handler) http.Handler {
+	return requireChecks(checks, false)
+}
+
+// RequireAll is like Require but the claims must pass every check
+func RequireAll(checks ...CheckFunc) func(http.Handler) http.Handler {
+	return requireChecks(checks, true)
+}
+
+// RequireRole only lets requests through when the claims have one of the roles
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	checks := make([]CheckFunc, 0, len(roles))
+	for _, role := range roles {
+		checks = append(checks, Check(auth.CheckRole{Role: role}))
+	}
+	return Require(checks...)
+}
+
+// Check is a CheckFunc for a check that doesn't depend on the request
+func Check(check auth.Check) CheckFunc {
+	return func(r *http.Request) auth.Check {
+		return check
+	}
+}
+
+// Int64Param is a CheckFunc that builds a check from an int64 path parameter, like
+// Int64Param("brand_id", func(id int64) auth.Check { return auth.CheckBrand{BrandID: id} }).
+// A missing or invalid parameter fails the check
+func Int64Param(name string, check func(id int64) auth.Check) CheckFunc {
+	return func(r *http.Request) auth.Check {
+		id, err := strconv.ParseInt(vestigo.Param(r, name), 10, 64)
+		if err != nil {
+			return nil
+		}
+		return check(id)
+	}
+}
+
+// StringParam is a CheckFunc that builds a check from a path parameter, like
+// StringParam("brand_uuid", func(uuid string) auth.Check { return auth.CheckBrandUUID{BrandUUID: uuid} }).
+// A missing parameter fails the check
+func StringParam(name string, check func(value string) auth.Check) CheckFunc {
+	return func(r *http.Request) auth.Check {
+		value := vestigo.Param(r, name)
+		if value == "" {
+			return nil
+		}
+		return check(value)
+	}
+}
+
+func requireChecks(checkFuncs []CheckFunc, all bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := GetClaimsFromCtx(r.Context())
+			if err != nil {
+				service.WriteProblem(w, "Could not find claims", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+				return
+			}
+
+			failed := failedChecks(r, claims, checkFuncs, all)
+			if len(failed) > 0 || len(checkFuncs) == 0 {
+				MustGetLoggerFromContext(r.Context()).WithField(logFieldFailedChecks, strings.Join(failed, ", ")).Printf("Permission check failed")
+				service.WriteProblem(w, "You do not have permission to do this", "FORBIDDEN", http.StatusForbidden, errors.New("permission check failed"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// failedChecks returns the checks the claims fail, when all is false it returns nothing if any of them pass
+func failedChecks(r *http.Request, claims auth.Claim, checkFuncs []CheckFunc, all bool) []string {
+	var failed []string
+	for _, checkFunc := range checkFuncs {
+		check := checkFunc(r)
+		if check != nil && check.Pass(claims) {
+			if !all {
+				return nil
+			}
+			continue
+		}
+		failed = append(failed, describeCheck(check))
+	}
+	return failed
+}
+
+// describeCheck returns the check's type and fields for the log, like auth.CheckBrand{BrandID:5}
+func describeCheck(check auth.Check) string {
+	if check == nil {
+		return "invalid path parameter"
+	}
+	return fmt.Sprintf("%T%+v", check, check)
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/husobee/vestigo"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_Require(t *testing.T) {
+	claims := auth.NewClaim([]int64{42}, nil, nil, time.Now().Add(time.Hour), nil, nil, []string{auth.RoleUser}, 7, "user-uuid", 0, "", nil)
+	brandParam := Int64Param("brand_id", func(id int64) auth.Check { return auth.CheckBrand{BrandID: id} })
+
+	testCases := []struct {
+		name       string
+		middleware func(http.Handler) http.Handler
+		claims     *auth.Claim
+		brandID    string
+		expected   int
+		logged     string
+	}{
+		{name: "no claims", middleware: Require(brandParam), brandID: "42", expected: http.StatusUnauthorized},
+		{name: "brand param passes", middleware: Require(brandParam), claims: &claims, brandID: "42", expected: http.StatusOK},
+		{name: "brand param fails", middleware: Require(brandParam), claims: &claims, brandID: "5", expected: http.StatusForbidden, logged: "auth.CheckBrand{BrandID:5}"},
+		{name: "invalid brand param", middleware: Require(brandParam), claims: &claims, brandID: "abc", expected: http.StatusForbidden, logged: "invalid path parameter"},
+		{name: "any passes", middleware: Require(Check(auth.CheckRole{Role: auth.RoleAdmin}), brandParam), claims: &claims, brandID: "42", expected: http.StatusOK},
+		{name: "all fails", middleware: RequireAll(Check(auth.CheckRole{Role: auth.RoleAdmin}), brandParam), claims: &claims, brandID: "42", expected: http.StatusForbidden, logged: "auth.CheckRole{Role:admin}"},
+		{name: "all passes", middleware: RequireAll(Check(auth.CheckUser{UserID: 7}), brandParam), claims: &claims, brandID: "42", expected: http.StatusOK},
+		{name: "role passes", middleware: RequireRole(auth.RoleAdmin, auth.RoleUser), claims: &claims, expected: http.StatusOK},
+		{name: "role fails", middleware: RequireRole(auth.RoleAdmin), claims: &claims, expected: http.StatusForbidden},
+		{name: "no checks", middleware: Require(), claims: &claims, expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			l := logrus.New()
+			l.Out = &logs
+
+			r := httptest.NewRequest(http.MethodGet, "/brand/"+tc.brandID, nil)
+			vestigo.AddParam(r, "brand_id", tc.brandID)
+			ctx := context.WithValue(r.Context(), contextkey.ContextKeyLogger, logrus.NewEntry(l))
+			if tc.claims != nil {
+				ctx = context.WithValue(ctx, contextkey.ContextKeyClaims, *tc.claims)
+			}
+
+			w := httptest.NewRecorder()
+			tc.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r.WithContext(ctx))
+
+			require.Equal(t, tc.expected, w.Code)
+			if tc.logged != "" {
+				require.Contains(t, logs.String(), tc.logged)
+				require.NotContains(t, w.Body.String(), tc.logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/promoboxx/go-service/service"
+)
+
+// ErrorTokenRevoked is the problem code for a valid token that was revoked
+const ErrorTokenRevoked = "TOKEN_REVOKED"
+
+// RevocationChecker checks if a token was revoked, either by its ID or because every token for its user
+// issued before some time was revoked
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, tokenID, userUUID string, issuedAt time.Time) (bool, error)
+}
+
+// Revoker revokes tokens
+type Revoker interface {
+	// RevokeToken revokes a single token, it only needs to be remembered until the token expires
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// RevokeUser revokes every token for the user issued before issuedBefore
+	RevokeUser(ctx context.Context, userUUID string, issuedBefore time.Time) error
+}
+
+// tokenPayload holds the registered claims go-auth doesn't expose on auth.Claim
+type tokenPayload struct {
+	ID       string `json:"jti"`
+	IssuedAt int64  `json:"iat"`
+}
+
+// TokenID returns the jti of the token, or a hash of the token when it doesn't have one, so any token can be revoked
+func TokenID(jwt string) string {
+	jwt = strings.TrimPrefix(jwt, "Bearer ")
+	if payload, err := parseTokenPayload(jwt); err == nil && payload.ID != "" {
+		return payload.ID
+	}
+
+	sum := sha256.Sum256([]byte(jwt))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseTokenPayload reads the payload without verifying the token, it must only be used on validated tokens
+func parseTokenPayload(jwt string) (tokenPayload, error) {
+	var payload tokenPayload
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return payload, errors.New("token does not have 3 parts")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return payload, err
+	}
+
+	err = json.Unmarshal(data, &payload)
+	return payload, err
+}
+
+// checkRevoked returns true if the validated token was revoked, writing the problem when it was or the check failed
+func checkRevoked(w http.ResponseWriter, r *http.Request, config AuthConfig, jwt, userUUID string) bool {
+	if config.Revocations == nil {
+		return false
+	}
+
+	jwt = strings.TrimPrefix(jwt, "Bearer ")
+	payload, _ := parseTokenPayload(jwt)
+
+	revoked, err := config.Revocations.IsRevoked(r.Context(), TokenID(jwt), userUUID, time.Unix(payload.IssuedAt, 0))
+	if err != nil {
+		if config.RevocationFailOpen {
+			MustGetLoggerFromContext(r.Context()).WithError(err).Printf("Could not check if the token was revoked")
+			return false
+		}
+		service.WriteProblem(w, "Could not check if the token was revoked", "REVOCATION_CHECK_FAILED", http.StatusInternalServerError, err)
+		return true
+	}
+	if revoked {
+		service.WriteProblem(w, "Token has been revoked", ErrorTokenRevoked, http.StatusUnauthorized, errors.New("token revoked"))
+		return true
+	}
+
+	return false
+}
+
+// LogOut revokes the token the request was made with, it should be placed after Auth
+func LogOut(revoker Revoker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := GetClaimsFromCtx(r.Context())
+		if err != nil {
+			service.WriteProblem(w, "Could not find claims", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+			return
+		}
+		jwt, err := GetJWTFromCtx(r.Context())
+		if err != nil {
+			service.WriteProblem(w, "Could not find token", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+			return
+		}
+
+		if err := revoker.RevokeToken(r.Context(), TokenID(jwt), claims.GetExpiration()); err != nil {
+			service.WriteProblem(w, "Could not revoke token", "REVOCATION_FAILED", http.StatusInternalServerError, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// LogOutEverywhere revokes every token issued so far for the user the request was made by, it should be placed after Auth
+func LogOutEverywhere(revoker Revoker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := GetClaimsFromCtx(r.Context())
+		if err != nil {
+			service.WriteProblem(w, "Could not find claims", "NOT_AUTHORIZED", http.StatusUnauthorized, err)
+			return
+		}
+
+		if err := revoker.RevokeUser(r.Context(), claims.GetUserUUID(), time.Now()); err != nil {
+			service.WriteProblem(w, "Could not revoke tokens", "REVOCATION_FAILED", http.StatusInternalServerError, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
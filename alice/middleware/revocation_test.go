@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRevocations revokes the token IDs and user UUIDs it holds
+type fakeRevocations struct {
+	tokenIDs  map[string]bool
+	userUUIDs map[string]bool
+	err       error
+}
+
+func (f *fakeRevocations) IsRevoked(ctx context.Context, tokenID, userUUID string, issuedAt time.Time) (bool, error) {
+	return f.tokenIDs[tokenID] || f.userUUIDs[userUUID], f.err
+}
+
+func TestUnit_AuthWithConfig_Revocations(t *testing.T) {
+	jwtWithID := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"jti":"token-1","iat":1700000000}`)) + ".signature"
+
+	testCases := []struct {
+		name        string
+		jwt         string
+		revocations *fakeRevocations
+		failOpen    bool
+		expected    int
+	}{
+		{name: "not revoked", jwt: jwtWithID, revocations: &fakeRevocations{}, expected: http.StatusOK},
+		{name: "token revoked", jwt: jwtWithID, revocations: &fakeRevocations{tokenIDs: map[string]bool{"token-1": true}}, expected: http.StatusUnauthorized},
+		{name: "token without id revoked by hash", jwt: "a", revocations: &fakeRevocations{tokenIDs: map[string]bool{TokenID("a"): true}}, expected: http.StatusUnauthorized},
+		{name: "user revoked", jwt: jwtWithID, revocations: &fakeRevocations{userUUIDs: map[string]bool{jwtWithID: true}}, expected: http.StatusUnauthorized},
+		{name: "check failed", jwt: jwtWithID, revocations: &fakeRevocations{err: errors.New("db down")}, expected: http.StatusInternalServerError},
+		{name: "check failed open", jwt: jwtWithID, revocations: &fakeRevocations{err: errors.New("db down")}, failOpen: true, expected: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the fake token uses the jwt as the user UUID
+			handler := AuthWithConfig(&fakeToken{expiresIn: time.Hour}, AuthConfig{Revocations: tc.revocations, RevocationFailOpen: tc.failOpen})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", tc.jwt)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusUnauthorized {
+				require.Contains(t, w.Body.String(), ErrorTokenRevoked)
+			}
+		})
+	}
+}
+
+func TestUnit_TokenID(t *testing.T) {
+	jwtWithID := "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"jti":"token-1"}`)) + ".signature"
+	require.Equal(t, "token-1", TokenID(jwtWithID))
+	require.Equal(t, "token-1", TokenID("Bearer "+jwtWithID))
+	require.Len(t, TokenID("header.e30.signature"), 64)
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/justinas/alice"
+)
+
+// RouteName adds the name given to Measure to the context so that middleware further down the
+// chain can make per route decisions
+func RouteName(name string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := routeNameKey.WithValue(r.Context(), name)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/promoboxx/go-service/service"
+)
+
+const (
+	// DefaultSessionCookie is the default cookie the JWT is kept in for browser clients
+	DefaultSessionCookie = "session"
+	// DefaultCSRFCookie is the default cookie holding the CSRF token, it's readable by javascript so it can be sent back in HeaderCSRFToken
+	DefaultCSRFCookie = "csrf_token"
+	// HeaderCSRFToken must hold the CSRF token on unsafe requests that are authenticated with the session cookie
+	HeaderCSRFToken = "X-CSRF-Token"
+
+	csrfTokenBytes = 32
+)
+
+// insecureEnvironments are served over plain http, so their cookies can't be Secure
+var insecureEnvironments = map[string]bool{
+	"local":       true,
+	"dev":         true,
+	"development": true,
+	"test":        true,
+}
+
+// safeMethods don't change anything so they don't need a CSRF token
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// SessionCookieConfig names the session and CSRF cookies
+type SessionCookieConfig struct {
+	// Name is the session cookie, defaults to DefaultSessionCookie
+	Name string
+	// CSRFName is the CSRF cookie, defaults to DefaultCSRFCookie
+	CSRFName string
+	// Domain is the domain of both cookies, empty uses the host of the request
+	Domain string
+}
+
+func (c SessionCookieConfig) withDefaults() SessionCookieConfig {
+	if c.Name == "" {
+		c.Name = DefaultSessionCookie
+	}
+	if c.CSRFName == "" {
+		c.CSRFName = DefaultCSRFCookie
+	}
+	return c
+}
+
+// SetSessionCookie puts the JWT in an HttpOnly session cookie along with a new CSRF token cookie. Outside of
+// local environments the cookies are Secure and SameSite=Strict
+func SetSessionCookie(w http.ResponseWriter, server service.Server, config SessionCookieConfig, jwt string, expiresAt time.Time) error {
+	config = config.withDefaults()
+
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessionCookie(server, config, config.Name, jwt, expiresAt, true))
+	http.SetCookie(w, sessionCookie(server, config, config.CSRFName, csrfToken, expiresAt, false))
+	return nil
+}
+
+// ClearSessionCookie removes the session and CSRF cookies
+func ClearSessionCookie(w http.ResponseWriter, server service.Server, config SessionCookieConfig) {
+	config = config.withDefaults()
+
+	expired := time.Unix(0, 0)
+	for _, name := range []string{config.Name, config.CSRFName} {
+		cookie := sessionCookie(server, config, name, "", expired, name == config.Name)
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+func sessionCookie(server service.Server, config SessionCookieConfig, name, value string, expiresAt time.Time, httpOnly bool) *http.Cookie {
+	secure := !insecureEnvironments[strings.ToLower(server.GetEnvironment())]
+	sameSite := http.SameSiteStrictMode
+	if !secure {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   config.Domain,
+		Expires:  expiresAt,
+		Secure:   secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	}
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CSRF checks the double submitted CSRF token on unsafe requests that have a session cookie, the X-CSRF-Token
+// header must match the CSRF cookie. Requests without the session cookie authenticate with a header a browser
+// won't send on its own, so they are let through. Auth checks the token itself when AuthConfig.Session is set,
+// CSRF is for routes that read the session some other way
+func CSRF(config SessionCookieConfig) func(http.Handler) http.Handler {
+	config = config.withDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if safeMethods[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, err := r.Cookie(config.Name); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !validCSRFToken(r, config) {
+				writeCSRFProblem(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validCSRFToken returns true if the X-CSRF-Token header matches the CSRF cookie
+func validCSRFToken(r *http.Request, config SessionCookieConfig) bool {
+	cookie, err := r.Cookie(config.CSRFName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(HeaderCSRFToken))) == 1
+}
+
+func writeCSRFProblem(w http.ResponseWriter) {
+	service.WriteProblem(w, "Missing or invalid CSRF token", "CSRF_TOKEN_INVALID", http.StatusForbidden, errors.New("csrf token mismatch"))
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/husobee/vestigo"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeServer struct {
+	environment string
+}
+
+func (f fakeServer) GetRouter() *vestigo.Router { return nil }
+func (f fakeServer) GetEnvironment() string     { return f.environment }
+func (f fakeServer) GetServiceName() string     { return "test-service" }
+
+func TestUnit_SetSessionCookie(t *testing.T) {
+	testCases := []struct {
+		environment string
+		secure      bool
+		sameSite    http.SameSite
+	}{
+		{environment: "production", secure: true, sameSite: http.SameSiteStrictMode},
+		{environment: "local", secure: false, sameSite: http.SameSiteLaxMode},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.environment, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			require.NoError(t, SetSessionCookie(w, fakeServer{environment: tc.environment}, SessionCookieConfig{}, "jwt", time.Now().Add(time.Hour)))
+
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 2)
+			require.Equal(t, DefaultSessionCookie, cookies[0].Name)
+			require.Equal(t, "jwt", cookies[0].Value)
+			require.True(t, cookies[0].HttpOnly)
+			require.Equal(t, DefaultCSRFCookie, cookies[1].Name)
+			require.NotEmpty(t, cookies[1].Value)
+			require.False(t, cookies[1].HttpOnly)
+			for _, cookie := range cookies {
+				require.Equal(t, tc.secure, cookie.Secure)
+				require.Equal(t, tc.sameSite, cookie.SameSite)
+			}
+
+			w = httptest.NewRecorder()
+			ClearSessionCookie(w, fakeServer{environment: tc.environment}, SessionCookieConfig{})
+			for _, cookie := range w.Result().Cookies() {
+				require.Empty(t, cookie.Value)
+				require.Equal(t, -1, cookie.MaxAge)
+			}
+		})
+	}
+}
+
+func TestUnit_CSRF(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		session  bool
+		cookie   string
+		header   string
+		expected int
+	}{
+		{name: "safe method", method: http.MethodGet, session: true, expected: http.StatusOK},
+		{name: "no session cookie", method: http.MethodPost, expected: http.StatusOK},
+		{name: "matching token", method: http.MethodPost, session: true, cookie: "token", header: "token", expected: http.StatusOK},
+		{name: "missing header", method: http.MethodPost, session: true, cookie: "token", expected: http.StatusForbidden},
+		{name: "mismatched token", method: http.MethodDelete, session: true, cookie: "token", header: "other", expected: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodPut, session: true, header: "token", expected: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/", nil)
+			if tc.session {
+				r.AddCookie(&http.Cookie{Name: DefaultSessionCookie, Value: "jwt"})
+			}
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: DefaultCSRFCookie, Value: tc.cookie})
+			}
+			if tc.header != "" {
+				r.Header.Set(HeaderCSRFToken, tc.header)
+			}
+
+			w := httptest.NewRecorder()
+			CSRF(SessionCookieConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			require.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestUnit_AuthWithConfig_SessionCookie(t *testing.T) {
+	var userUUID string
+	config := AuthConfig{Session: &SessionCookieConfig{Name: "admin_session"}}
+	handler := AuthWithConfig(&fakeToken{expiresIn: time.Hour}, config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userUUID = MustGetClaimsFromContext(r.Context()).GetUserUUID()
+	}))
+
+	// the fake token uses the jwt as the user UUID
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "admin_session", Value: "cookie-jwt"})
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, "cookie-jwt", userUUID)
+
+	r.Header.Set("Authorization", "header-jwt")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, "header-jwt", userUUID)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUnit_AuthWithConfig_SessionCookieCSRF(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		bearer   bool
+		expected int
+	}{
+		{name: "matching token", header: "token", expected: http.StatusOK},
+		{name: "missing token", expected: http.StatusForbidden},
+		{name: "mismatched token", header: "other", expected: http.StatusForbidden},
+		// the header isn't something a browser sends on its own
+		{name: "authorization header", bearer: true, expected: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := AuthWithConfig(&fakeToken{expiresIn: time.Hour}, AuthConfig{Session: &SessionCookieConfig{Name: "admin_session"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.AddCookie(&http.Cookie{Name: "admin_session", Value: "cookie-jwt"})
+			r.AddCookie(&http.Cookie{Name: DefaultCSRFCookie, Value: "token"})
+			if tc.header != "" {
+				r.Header.Set(HeaderCSRFToken, tc.header)
+			}
+			if tc.bearer {
+				r.Header.Set("Authorization", "header-jwt")
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			require.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
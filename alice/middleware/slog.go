@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logrusHandler is a slog.Handler that writes through a logrus entry so slog and logrus
+// output share the same formatter, fields and destination
+type logrusHandler struct {
+	entry  *logrus.Entry
+	attrs  logrus.Fields
+	groups []string
+}
+
+// NewLogrusHandler creates a slog.Handler that writes records through the logrus entry
+func NewLogrusHandler(entry *logrus.Entry) slog.Handler {
+	return &logrusHandler{entry: entry, attrs: logrus.Fields{}}
+}
+
+// Enabled returns true if the logrus logger would log at the level
+func (h *logrusHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.entry.Logger.IsLevelEnabled(logrusLevel(level))
+}
+
+// Handle writes the record with its attributes as logrus fields
+func (h *logrusHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make(logrus.Fields, len(h.attrs)+record.NumAttrs())
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+
+	record.Attrs(func(a slog.Attr) bool {
+		addAttr(fields, h.groups, a)
+		return true
+	})
+
+	entry := h.entry.WithFields(fields)
+	if !record.Time.IsZero() {
+		entry = entry.WithTime(record.Time)
+	}
+	entry.Log(logrusLevel(record.Level), record.Message)
+
+	return nil
+}
+
+// WithAttrs returns a handler that adds the attributes to every record
+func (h *logrusHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(logrus.Fields, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+	for _, a := range attrs {
+		addAttr(fields, h.groups, a)
+	}
+
+	return &logrusHandler{entry: h.entry, attrs: fields, groups: h.groups}
+}
+
+// WithGroup returns a handler that prefixes the keys of following attributes with the group name
+func (h *logrusHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	groups := make([]string, len(h.groups), len(h.groups)+1)
+	copy(groups, h.groups)
+
+	return &logrusHandler{entry: h.entry, attrs: h.attrs, groups: append(groups, name)}
+}
+
+// addAttr adds the attribute to fields, flattening groups into dot separated keys
+func addAttr(fields logrus.Fields, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range a.Value.Group() {
+			addAttr(fields, groups, ga)
+		}
+		return
+	}
+
+	key := a.Key
+	for i := len(groups) - 1; i >= 0; i-- {
+		key = groups[i] + "." + key
+	}
+	fields[key] = a.Value.Any()
+}
+
+// logrusLevel converts a slog level to the closest logrus level
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level >= slog.LevelError:
+		return logrus.ErrorLevel
+	case level >= slog.LevelWarn:
+		return logrus.WarnLevel
+	case level >= slog.LevelInfo:
+		return logrus.InfoLevel
+	case level >= slog.LevelDebug:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_LogrusHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := logrus.New()
+	l.Out = buf
+	l.Formatter = &logrus.JSONFormatter{}
+	l.SetLevel(logrus.InfoLevel)
+
+	entry := logrus.NewEntry(l).WithField(logFieldRequestID, "abc")
+	logger := slog.New(NewLogrusHandler(entry))
+
+	logger.Debug("not logged")
+	require.Zero(t, buf.Len())
+
+	logger.With("user_id", "42").WithGroup("db").Warn("slow query", "table", "users", slog.Group("timing", "ms", 12))
+
+	line := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "slow query", line["msg"])
+	require.Equal(t, "warning", line["level"])
+	require.Equal(t, "abc", line[logFieldRequestID])
+	require.Equal(t, "42", line["user_id"])
+	require.Equal(t, "users", line["db.table"])
+	require.Equal(t, float64(12), line["db.timing.ms"])
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// span tags for the identity and canary version
+const (
+	spanTagUserID        = "usr.id"
+	spanTagUserUUID      = "usr.uuid"
+	spanTagAPIKeyID      = "usr.api_key_id"
+	spanTagAuthMethod    = "usr.auth_method"
+	spanTagVerified      = "usr.verified"
+	spanTagCanaryVersion = "canary.version"
+)
+
+// spanIDer is implemented by span contexts that have numeric ids, like the datadog tracer's
+type spanIDer interface {
+	TraceID() uint64
+	SpanID() uint64
+}
+
+// GetSpanIDsFromCtx returns the trace and span ids of the active span in the context, ok is false when
+// there is no span or the tracer does not use numeric ids
+func GetSpanIDsFromCtx(ctx context.Context) (traceID uint64, spanID uint64, ok bool) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return 0, 0, false
+	}
+
+	ids, ok := span.Context().(spanIDer)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return ids.TraceID(), ids.SpanID(), true
+}
+
+// TagSpanWithIdentity tags the active span in the context with the identity of the request, for spans
+// started after the identity was set
+func TagSpanWithIdentity(ctx context.Context) {
+	tagSpanWithIdentity(ctx, GetIdentityOrAnonymous(ctx))
+}
+
+// tagSpanWithIdentity tags the active span with who made the request
+func tagSpanWithIdentity(ctx context.Context, identity Identity) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	if identity.UserID != 0 {
+		span.SetTag(spanTagUserID, strconv.FormatInt(identity.UserID, 10))
+	}
+	if identity.UserUUID != "" {
+		span.SetTag(spanTagUserUUID, identity.UserUUID)
+	}
+	if identity.APIKeyID != "" {
+		span.SetTag(spanTagAPIKeyID, identity.APIKeyID)
+	}
+	span.SetTag(spanTagAuthMethod, string(identity.Method))
+	span.SetTag(spanTagVerified, identity.Verified)
+}
@@ -24,3 +24,25 @@ func (n *nullTimer) Time(name string) alice.Constructor {
 func NewNullTimer() Timer {
 	return &nullTimer{}
 }
+
+type compositeTimer struct {
+	timers []Timer
+}
+
+// NewCompositeTimer runs each of the timers for every request, the first timer is the outermost.
+// Expected usage:
+// t := middleware.NewCompositeTimer(trace.NewOpenTracingTimer(), middleware.NewMetricsTimer(serviceName, metricsClient))
+func NewCompositeTimer(timers ...Timer) Timer {
+	return &compositeTimer{timers: timers}
+}
+
+func (c *compositeTimer) Time(name string) alice.Constructor {
+	constructors := make([]alice.Constructor, 0, len(c.timers))
+	for _, t := range c.timers {
+		constructors = append(constructors, t.Time(name))
+	}
+
+	return func(h http.Handler) http.Handler {
+		return alice.New(constructors...).Then(h)
+	}
+}
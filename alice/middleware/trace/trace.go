@@ -3,6 +3,8 @@ package trace
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
@@ -11,16 +13,45 @@ import (
 	"github.com/justinas/alice"
 	"github.com/opentracing/opentracing-go"
 	otext "github.com/opentracing/opentracing-go/ext"
+	"github.com/promoboxx/go-glitch/glitch"
 	"github.com/promoboxx/go-service/alice/middleware"
 	"github.com/promoboxx/go-service/alice/middleware/lrw"
 )
 
+// span tags set by the timer in addition to the datadog ones
+const (
+	TagHTTPRoute      = "http.route"
+	TagRequestID      = "request_id"
+	TagCanaryVersion  = "canary.version"
+	TagResponseSize   = "http.response.size"
+	TagErrorCode      = "error.code"
+	TagErrorTransient = "error.transient"
+)
+
+const redacted = "REDACTED"
+
+// TimerConfig holds the optional behavior of an opentracing timer
+type TimerConfig struct {
+	// RedactQueryParams are query parameters whose values are replaced before the url is tagged
+	RedactQueryParams []string
+}
+
 type openTracingTimer struct {
+	redact map[string]bool
 }
 
 // NewOpenTracingTimer creates a new Tracer that uses opentracing spans
 func NewOpenTracingTimer() middleware.Timer {
-	return &openTracingTimer{}
+	return NewOpenTracingTimerWithConfig(TimerConfig{})
+}
+
+// NewOpenTracingTimerWithConfig creates a new Tracer that uses opentracing spans with the optional behavior in config
+func NewOpenTracingTimerWithConfig(config TimerConfig) middleware.Timer {
+	redact := make(map[string]bool, len(config.RedactQueryParams))
+	for _, param := range config.RedactQueryParams {
+		redact[param] = true
+	}
+	return &openTracingTimer{redact: redact}
 }
 
 // Time returns a middleware that will handle creating spans and tracing
@@ -29,40 +60,45 @@ func (ott *openTracingTimer) Time(name string) alice.Constructor {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// make the response writer a logging response writer so we can access the status code
-			w = lrw.NewLoggingResponseWriter(w)
+			w = lrw.Wrap(w)
 			var span opentracing.Span
 			ctx := r.Context()
 
 			// attempt to extract any span information in case this request is coming from somewhere
-			// that may have already set one
-			sctx, err := opentracing.GlobalTracer().Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
-			if err != nil && (err != tracer.ErrSpanContextNotFound || err != opentracing.ErrSpanContextNotFound) {
+			// that may have already set one, W3C trace context is mapped to datadog headers first
+			carrier, incoming := extractHeaders(r.Header)
+			sctx, err := opentracing.GlobalTracer().Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(carrier))
+			if err != nil && err != tracer.ErrSpanContextNotFound && err != opentracing.ErrSpanContextNotFound {
 				log.Printf("error extracting span data: %v", err)
 			}
 
 			// start a new span as a child of the existing span
-			span, ctx = opentracing.StartSpanFromContext(r.Context(), "http.request", opentracing.ChildOf(sctx))
+			span, ctx = opentracing.StartSpanFromContext(withIncomingTrace(ctx, incoming), "http.request", opentracing.ChildOf(sctx))
 
 			// required to get trace search and analytics
 			span.SetTag(ext.AnalyticsEvent, true)
 			// sets the name of the request that gets passed into measure
 			span.SetTag(ext.ResourceName, name)
-			span.SetTag(ext.HTTPURL, r.URL.String())
+			span.SetTag(ext.HTTPURL, ott.url(r.URL))
 			span.SetTag(ext.HTTPMethod, r.Method)
-			defer span.Finish()
-
-			// inject the span information into the http headers so when we send off to another internal
-			// service it will have the information to chain everything together
-			err = opentracing.GlobalTracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
-			if err != nil {
-				log.Printf("error injecting span data: %v", err)
+			span.SetTag(TagHTTPRoute, routeTemplate(r, name))
+			if requestID, err := middleware.GetRequestIDFromCtx(ctx); err == nil {
+				span.SetTag(TagRequestID, requestID)
 			}
+			if canary, err := middleware.GetCanaryVersionFromCtx(ctx); err == nil && canary != "" {
+				span.SetTag(TagCanaryVersion, canary)
+			}
+			defer span.Finish()
 
 			h.ServeHTTP(w, r.WithContext(ctx))
 
+			// auth can run before the span exists, so tag whoever the request ended up being made by
+			middleware.TagSpanWithIdentity(ctx)
+
 			// set some tags based on status code
 			if lrw, ok := w.(*lrw.LoggingResponseWriter); ok {
 				otext.HTTPStatusCode.Set(span, uint16(lrw.StatusCode))
+				span.SetTag(TagResponseSize, lrw.BytesWritten)
 
 				if lrw.StatusCode > 299 || lrw.StatusCode < 200 {
 					otext.Error.Set(span, true)
@@ -70,8 +106,101 @@ func (ott *openTracingTimer) Time(name string) alice.Constructor {
 					if lrw.InnerError != nil {
 						span.SetTag(ext.Error, lrw.InnerError)
 					}
+
+					if dataErr, ok := lrw.InnerError.(glitch.DataError); ok {
+						span.SetTag(TagErrorCode, dataErr.Code())
+						span.SetTag(TagErrorTransient, dataErr.IsTransient())
+					} else if code, ok := lrw.ExtraFields["error_code"]; ok {
+						span.SetTag(TagErrorCode, code)
+					}
 				}
 			}
 		})
 	}
 }
+
+// url returns the url to tag the span with, without the parameters vestigo adds to the query
+// and with the configured query parameters redacted
+func (ott *openTracingTimer) url(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+
+	query := u.Query()
+	for k := range query {
+		if strings.HasPrefix(k, ":") {
+			query.Del(k)
+			continue
+		}
+		if ott.redact[k] {
+			query[k] = []string{redacted}
+		}
+	}
+
+	tagged := *u
+	tagged.RawQuery = query.Encode()
+	return tagged.String()
+}
+
+// routeParam is a vestigo route parameter and its value
+type routeParam struct {
+	name  string
+	value string
+}
+
+// routeParams returns the vestigo route parameters in path order, vestigo appends them to the raw query
+// as it matches the path
+func routeParams(r *http.Request) []routeParam {
+	var params []routeParam
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil || !strings.HasPrefix(name, ":") {
+			continue
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		params = append(params, routeParam{name: name[1:], value: value})
+	}
+	return params
+}
+
+// routeTemplate rebuilds the vestigo route template (/user/:id) by putting the parameter names
+// back in place of the path segments that hold their values, in path order. When that's ambiguous,
+// like a value that's also a static segment of the route, the route name is used instead so the
+// tag never holds raw values
+func routeTemplate(r *http.Request, name string) string {
+	params := routeParams(r)
+	if len(params) == 0 {
+		return r.URL.Path
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+	counts := make(map[string]int, len(segments))
+	for _, segment := range segments {
+		counts[segment]++
+	}
+	for _, param := range params {
+		counts[param.value]--
+	}
+	for _, param := range params {
+		if param.value == "" || counts[param.value] != 0 {
+			return name
+		}
+	}
+
+	next := 0
+	for i, segment := range segments {
+		if next < len(params) && segment == params[next].value {
+			segments[i] = ":" + params[next].name
+			next++
+		}
+	}
+	if next != len(params) {
+		return name
+	}
+
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/husobee/vestigo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_RouteTemplate(t *testing.T) {
+	type param struct{ name, value string }
+
+	testCases := []struct {
+		name     string
+		path     string
+		params   []param
+		expected string
+	}{
+		{
+			name:     "no params",
+			path:     "/health",
+			expected: "/health",
+		},
+		{
+			name:     "same values",
+			path:     "/brand/12/post/12",
+			params:   []param{{"brandID", "12"}, {"postID", "12"}},
+			expected: "/brand/:brandID/post/:postID",
+		},
+		{
+			name:     "path order",
+			path:     "/brand/a/post/b",
+			params:   []param{{"brandID", "a"}, {"postID", "b"}},
+			expected: "/brand/:brandID/post/:postID",
+		},
+		{
+			name:     "value matches a static segment",
+			path:     "/brand/brand",
+			params:   []param{{"name", "brand"}},
+			expected: "get brand",
+		},
+		{
+			name:     "value spans segments",
+			path:     "/files/a/b",
+			params:   []param{{"path", "a/b"}},
+			expected: "get brand",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for _, p := range tc.params {
+				vestigo.AddParam(r, p.name, p.value)
+			}
+
+			require.Equal(t, tc.expected, routeTemplate(r, "get brand"))
+		})
+	}
+}
+
+func TestUnit_TimerURL(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/user/12?token=secret&page=2", nil)
+	vestigo.AddParam(r, "id", "12")
+
+	ott := NewOpenTracingTimerWithConfig(TimerConfig{RedactQueryParams: []string{"token"}}).(*openTracingTimer)
+	require.Equal(t, "/user/12?page=2&token=REDACTED", ott.url(r.URL))
+}
+
+func TestUnit_TimerDoesNotModifyRequestHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/user/12", nil)
+	NewOpenTracingTimer().Time("get user")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+
+	require.Empty(t, r.Header)
+}
@@ -0,0 +1,105 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+var incomingTraceKey = contextkey.Of[*incomingTrace](contextkey.ContextKeyTraceContext)
+
+// incomingTrace is the W3C trace context a request arrived with, it is kept in the context so the parts
+// that don't fit in a datadog span context (the upper trace id bits, flags and tracestate) are passed on
+type incomingTrace struct {
+	parent middleware.TraceParent
+	state  string
+}
+
+// extractHeaders returns the headers to extract a span context from. When the request has a valid traceparent
+// and no datadog headers, a copy of the headers with the traceparent mapped to datadog headers is returned
+func extractHeaders(h http.Header) (http.Header, *incomingTrace) {
+	tp, ok := middleware.ParseTraceParent(h.Get(middleware.HeaderTraceParent))
+	if !ok {
+		return h, nil
+	}
+	incoming := &incomingTrace{parent: tp, state: h.Get(middleware.HeaderTraceState)}
+
+	if h.Get(tracer.DefaultTraceIDHeader) != "" {
+		return h, incoming
+	}
+
+	priority := "0"
+	if tp.Sampled() {
+		priority = "1"
+	}
+
+	carrier := h.Clone()
+	carrier.Set(tracer.DefaultTraceIDHeader, strconv.FormatUint(binary.BigEndian.Uint64(tp.TraceID[8:]), 10))
+	carrier.Set(tracer.DefaultParentIDHeader, strconv.FormatUint(binary.BigEndian.Uint64(tp.ParentID[:]), 10))
+	carrier.Set(tracer.DefaultPriorityHeader, priority)
+
+	return carrier, incoming
+}
+
+// withIncomingTrace adds the incoming W3C trace context to ctx
+func withIncomingTrace(ctx context.Context, incoming *incomingTrace) context.Context {
+	if incoming == nil {
+		return ctx
+	}
+	return incomingTraceKey.WithValue(ctx, incoming)
+}
+
+func getIncomingTrace(ctx context.Context) *incomingTrace {
+	incoming, _ := incomingTraceKey.Get(ctx)
+	return incoming
+}
+
+// Inject writes the active span of ctx into h using the global tracer's propagation along with
+// W3C traceparent and tracestate headers, so both datadog and W3C aware services can continue the trace
+func Inject(ctx context.Context, h http.Header) {
+	span := opentracing.SpanFromContext(ctx)
+	if span != nil {
+		err := opentracing.GlobalTracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(h))
+		if err != nil {
+			log.Printf("error injecting span data: %v", err)
+		}
+	}
+
+	incoming := getIncomingTrace(ctx)
+	if tp, ok := traceParent(ctx, incoming); ok {
+		h.Set(middleware.HeaderTraceParent, tp.String())
+	}
+	if incoming != nil && incoming.state != "" {
+		h.Set(middleware.HeaderTraceState, incoming.state)
+	}
+}
+
+// traceParent builds the traceparent for the active span, keeping the upper trace id bits and flags of
+// the incoming trace when it is the same trace. Without span ids the incoming traceparent is passed on as is
+func traceParent(ctx context.Context, incoming *incomingTrace) (middleware.TraceParent, bool) {
+	traceID, spanID, ok := middleware.GetSpanIDsFromCtx(ctx)
+	if !ok || traceID == 0 || spanID == 0 {
+		if incoming != nil {
+			return incoming.parent, true
+		}
+		return middleware.TraceParent{}, false
+	}
+
+	tp := middleware.TraceParent{Flags: 0x01}
+	binary.BigEndian.PutUint64(tp.TraceID[8:], traceID)
+	binary.BigEndian.PutUint64(tp.ParentID[:], spanID)
+
+	if incoming != nil && binary.BigEndian.Uint64(incoming.parent.TraceID[8:]) == traceID {
+		copy(tp.TraceID[:8], incoming.parent.TraceID[:8])
+		tp.Flags = incoming.parent.Flags
+	}
+
+	return tp, true
+}
@@ -0,0 +1,75 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestUnit_ExtractHeaders(t *testing.T) {
+	tests := map[string]struct {
+		headers  map[string]string
+		validate func(t *testing.T, original, carrier http.Header, incoming *incomingTrace)
+	}{
+		"traceparent is mapped to datadog headers": {
+			headers: map[string]string{
+				middleware.HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				middleware.HeaderTraceState:  "congo=t61rcWkgMzE",
+			},
+			validate: func(t *testing.T, original, carrier http.Header, incoming *incomingTrace) {
+				require.Equal(t, "11803532876627986230", carrier.Get(tracer.DefaultTraceIDHeader))
+				require.Equal(t, "67667974448284343", carrier.Get(tracer.DefaultParentIDHeader))
+				require.Equal(t, "1", carrier.Get(tracer.DefaultPriorityHeader))
+				require.Empty(t, original.Get(tracer.DefaultTraceIDHeader), "request headers should not be modified")
+				require.NotNil(t, incoming)
+				require.Equal(t, "congo=t61rcWkgMzE", incoming.state)
+			},
+		},
+		"datadog headers take precedence": {
+			headers: map[string]string{
+				middleware.HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				tracer.DefaultTraceIDHeader:  "123",
+			},
+			validate: func(t *testing.T, original, carrier http.Header, incoming *incomingTrace) {
+				require.Equal(t, "123", carrier.Get(tracer.DefaultTraceIDHeader))
+				require.NotNil(t, incoming)
+			},
+		},
+		"no traceparent": {
+			headers: map[string]string{},
+			validate: func(t *testing.T, original, carrier http.Header, incoming *incomingTrace) {
+				require.Nil(t, incoming)
+				require.Empty(t, carrier.Get(tracer.DefaultTraceIDHeader))
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tc.headers {
+				h.Set(k, v)
+			}
+
+			carrier, incoming := extractHeaders(h)
+			tc.validate(t, h, carrier, incoming)
+		})
+	}
+}
+
+func TestUnit_InjectPassesIncomingTraceOn(t *testing.T) {
+	h := http.Header{}
+	h.Set(middleware.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(middleware.HeaderTraceState, "congo=t61rcWkgMzE")
+	_, incoming := extractHeaders(h)
+
+	out := http.Header{}
+	Inject(withIncomingTrace(context.Background(), incoming), out)
+
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", out.Get(middleware.HeaderTraceParent))
+	require.Equal(t, "congo=t61rcWkgMzE", out.Get(middleware.HeaderTraceState))
+}
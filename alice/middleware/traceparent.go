@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+const traceParentLength = 55
+
+// TraceParent is a parsed W3C traceparent header
+type TraceParent struct {
+	TraceID  [16]byte
+	ParentID [8]byte
+	Flags    byte
+}
+
+// ParseTraceParent parses a traceparent header, returning false if it is not valid
+func ParseTraceParent(header string) (TraceParent, bool) {
+	var tp TraceParent
+
+	header = strings.TrimSpace(header)
+	if len(header) < traceParentLength {
+		return tp, false
+	}
+
+	version, err := decodeLowerHex(header[0:2])
+	if err != nil || version[0] == 0xff {
+		return tp, false
+	}
+	// version 00 has a fixed length, later versions may add fields after the flags
+	if version[0] == 0 && len(header) != traceParentLength {
+		return tp, false
+	}
+	if len(header) > traceParentLength && header[traceParentLength] != '-' {
+		return tp, false
+	}
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return tp, false
+	}
+
+	traceID, err := decodeLowerHex(header[3:35])
+	if err != nil || isZero(traceID) {
+		return tp, false
+	}
+	parentID, err := decodeLowerHex(header[36:52])
+	if err != nil || isZero(parentID) {
+		return tp, false
+	}
+	flags, err := decodeLowerHex(header[53:55])
+	if err != nil {
+		return tp, false
+	}
+
+	copy(tp.TraceID[:], traceID)
+	copy(tp.ParentID[:], parentID)
+	tp.Flags = flags[0]
+
+	return tp, true
+}
+
+// TraceIDHex returns the trace ID as 32 lowercase hex characters
+func (tp TraceParent) TraceIDHex() string {
+	return hex.EncodeToString(tp.TraceID[:])
+}
+
+// Sampled returns true if the sampled flag is set
+func (tp TraceParent) Sampled() bool {
+	return tp.Flags&0x01 == 0x01
+}
+
+// String formats the trace parent as a version 00 header
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%x-%x-%02x", tp.TraceID[:], tp.ParentID[:], tp.Flags)
+}
+
+// decodeLowerHex decodes hex, rejecting upper case characters as the spec requires
+func decodeLowerHex(s string) ([]byte, error) {
+	if strings.ToLower(s) != s {
+		return nil, fmt.Errorf("%q is not lower case hex", s)
+	}
+	return hex.DecodeString(s)
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -1,12 +1,9 @@
 package middleware
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
-
-	"github.com/promoboxx/go-service/alice/middleware/contextkey"
 )
 
 type JWTDecoder interface {
@@ -30,6 +27,11 @@ func NewUserIDInjector(jwt JWTDecoder) UserIDIngector {
 func (u *userIDInjector) Inject(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var userID string
+		identity := Identity{Method: AuthMethodAnonymous}
+		if r.Header.Get(HeaderAPIKey) != "" || strings.HasPrefix(r.Header.Get("Authorization"), authSchemeAPIKey) {
+			identity.Method = AuthMethodAPIKey
+		}
+
 		t := r.Header.Get("Authorization")
 		t = strings.TrimPrefix(t, "Bearer ")
 		parts := strings.Split(t, ".")
@@ -37,6 +39,7 @@ func (u *userIDInjector) Inject(h http.Handler) http.Handler {
 		if len(parts) == 3 {
 			by, err := u.jwtDecoder.DecodeSegment(parts[1])
 			if err == nil {
+				identity = unverifiedIdentity(by)
 				claims := make(map[string]interface{})
 				err = json.Unmarshal(by, &claims)
 				if err == nil {
@@ -50,8 +53,9 @@ func (u *userIDInjector) Inject(h http.Handler) http.Handler {
 			}
 		}
 
-		// add userID to the context
-		ctx := context.WithValue(r.Context(), contextkey.ContextKeyInsecureUserID, userID)
+		// add userID and the unverified identity to the context
+		ctx := insecureUserIDKey.WithValue(r.Context(), userID)
+		ctx = setIdentity(ctx, identity)
 		r = r.WithContext(ctx)
 		h.ServeHTTP(w, r)
 	})
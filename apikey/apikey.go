@@ -0,0 +1,67 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+)
+
+// keyBytes is how much randomness a generated key has
+const keyBytes = 32
+
+// Generate returns a new random API key, only its hash (see middleware.HashAPIKey) should be stored
+func Generate() (string, error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+var _ middleware.APIKeyStore = &MemoryStore{}
+
+// MemoryStore keeps API keys in memory, it's meant for tests and keys loaded from config
+type MemoryStore struct {
+	mu       sync.RWMutex
+	keys     map[string]middleware.APIKey
+	lastUsed map[string]time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: map[string]middleware.APIKey{}, lastUsed: map[string]time.Time{}}
+}
+
+// Add stores the key under its hash
+func (s *MemoryStore) Add(hash string, key middleware.APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[hash] = key
+}
+
+// GetAPIKey returns the key with the hash
+func (s *MemoryStore) GetAPIKey(ctx context.Context, hash string) (middleware.APIKey, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[hash]
+	return key, ok, nil
+}
+
+// MarkAPIKeyUsed records when the key was last used
+func (s *MemoryStore) MarkAPIKeyUsed(ctx context.Context, id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed[id] = usedAt
+	return nil
+}
+
+// LastUsed returns when the key was last used, zero if it hasn't been
+func (s *MemoryStore) LastUsed(id string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastUsed[id]
+}
@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_APIKeyAuth(t *testing.T) {
+	pepper := []byte("pepper")
+	rawKey, err := Generate()
+	require.NoError(t, err)
+	expiredKey, err := Generate()
+	require.NoError(t, err)
+
+	store := NewMemoryStore()
+	store.Add(middleware.HashAPIKey(rawKey, pepper), middleware.APIKey{ID: "partner", UserUUID: "partner-uuid", Roles: []string{auth.RoleApi}, Brands: []int64{42}})
+	store.Add(middleware.HashAPIKey(expiredKey, pepper), middleware.APIKey{ID: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	fallback := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+
+	testCases := []struct {
+		name     string
+		headers  map[string]string
+		fallback func(http.Handler) http.Handler
+		expected int
+	}{
+		{name: "header", headers: map[string]string{middleware.HeaderAPIKey: rawKey}, expected: http.StatusOK},
+		{name: "authorization", headers: map[string]string{"Authorization": "ApiKey " + rawKey}, expected: http.StatusOK},
+		{name: "unknown key", headers: map[string]string{middleware.HeaderAPIKey: "nope"}, expected: http.StatusUnauthorized},
+		{name: "wrong pepper", headers: map[string]string{middleware.HeaderAPIKey: middleware.HashAPIKey(rawKey, pepper)}, expected: http.StatusUnauthorized},
+		{name: "expired key", headers: map[string]string{middleware.HeaderAPIKey: expiredKey}, expected: http.StatusUnauthorized},
+		{name: "no key", expected: http.StatusUnauthorized},
+		{name: "no key with fallback", fallback: fallback, expected: http.StatusTeapot},
+		{name: "jwt with fallback", headers: map[string]string{"Authorization": "Bearer jwt"}, fallback: fallback, expected: http.StatusTeapot},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var claims auth.Claim
+			handler := middleware.APIKeyAuth(store, middleware.APIKeyConfig{Pepper: pepper, Fallback: tc.fallback})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims = middleware.MustGetClaimsFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.expected, w.Code)
+			if tc.expected == http.StatusOK {
+				require.Equal(t, "partner-uuid", claims.GetUserUUID())
+				require.True(t, claims.HasPermission(auth.CheckBrand{BrandID: 42}))
+				require.True(t, claims.IsApi())
+			}
+		})
+	}
+
+	require.Eventually(t, func() bool { return !store.LastUsed("partner").IsZero() }, time.Second, 5*time.Millisecond)
+}
+
+func TestUnit_APIKeyAuth_EmptyPepper(t *testing.T) {
+	require.PanicsWithValue(t, middleware.ErrEmptyPepper, func() { middleware.APIKeyAuth(NewMemoryStore(), middleware.APIKeyConfig{}) })
+	require.PanicsWithValue(t, middleware.ErrEmptyPepper, func() { middleware.HashAPIKey("key", nil) })
+}
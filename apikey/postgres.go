@@ -0,0 +1,90 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/database/connector"
+)
+
+// Schema creates the table the postgres store uses
+const Schema = `CREATE TABLE IF NOT EXISTS api_key (
+	id           text PRIMARY KEY,
+	key_hash     text NOT NULL UNIQUE,
+	name         text NOT NULL,
+	user_id      bigint NOT NULL DEFAULT 0,
+	user_uuid    text NOT NULL DEFAULT '',
+	roles        text[] NOT NULL DEFAULT '{}',
+	brands       bigint[] NOT NULL DEFAULT '{}',
+	retailers    bigint[] NOT NULL DEFAULT '{}',
+	expires_at   timestamptz,
+	revoked_at   timestamptz,
+	last_used_at timestamptz
+)`
+
+const (
+	selectKey = `SELECT id, name, user_id, user_uuid, roles, brands, retailers, expires_at
+	FROM api_key WHERE key_hash = $1 AND revoked_at IS NULL`
+
+	updateLastUsed = `UPDATE api_key SET last_used_at = GREATEST(last_used_at, $2) WHERE id = $1`
+)
+
+var _ middleware.APIKeyStore = &PostgresStore{}
+
+// PostgresStore keeps API keys in the api_key table (see Schema), keys are revoked by setting revoked_at
+type PostgresStore struct {
+	connector connector.SQLDBConnector
+}
+
+// NewPostgresStore creates a PostgresStore that gets its connection from the connector
+func NewPostgresStore(dbConnector connector.SQLDBConnector) *PostgresStore {
+	return &PostgresStore{connector: dbConnector}
+}
+
+// GetAPIKey returns the unrevoked key with the hash
+func (s *PostgresStore) GetAPIKey(ctx context.Context, hash string) (middleware.APIKey, bool, error) {
+	var key middleware.APIKey
+
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return key, false, err
+	}
+
+	var expiresAt sql.NullTime
+	err = db.QueryRowContext(ctx, selectKey, hash).Scan(
+		&key.ID,
+		&key.Name,
+		&key.UserID,
+		&key.UserUUID,
+		pq.Array(&key.Roles),
+		pq.Array(&key.Brands),
+		pq.Array(&key.Retailers),
+		&expiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return key, false, nil
+	}
+	if err != nil {
+		return key, false, fmt.Errorf("could not get API key: %v", err)
+	}
+	key.ExpiresAt = expiresAt.Time
+
+	return key, true, nil
+}
+
+// MarkAPIKeyUsed records when the key was last used
+func (s *PostgresStore) MarkAPIKeyUsed(ctx context.Context, id string, usedAt time.Time) error {
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, updateLastUsed, id, usedAt); err != nil {
+		return fmt.Errorf("could not mark API key used: %v", err)
+	}
+	return nil
+}
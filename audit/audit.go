@@ -0,0 +1,305 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/husobee/vestigo"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/alice/middleware/lrw"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBufferSize    = 1000
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultWriteTimeout  = 10 * time.Second
+)
+
+// ErrClosed is returned when recording an event after the Auditor was closed
+var ErrClosed = errors.New("auditor is closed")
+
+// Event records who did what to which route
+type Event struct {
+	Time      time.Time         `json:"time"`
+	RequestID string            `json:"request_id"`
+	Route     string            `json:"route"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params,omitempty"`
+	Status    int               `json:"status"`
+	// UserID and UserUUID are who the request acted as
+	UserID   int64  `json:"user_id"`
+	UserUUID string `json:"user_uuid"`
+	// InitiatingUserID and InitiatingUserUUID are who made the request, they differ from the user when impersonating
+	InitiatingUserID   int64  `json:"initiating_user_id"`
+	InitiatingUserUUID string `json:"initiating_user_uuid"`
+	Impersonated       bool   `json:"impersonated"`
+	// AuthMethod is how the request authenticated, APIKeyID is set when it was with an API key
+	AuthMethod string `json:"auth_method"`
+	APIKeyID   string `json:"api_key_id,omitempty"`
+	// Diff is supplied by the handler with SetDiff
+	Diff json.RawMessage `json:"diff,omitempty"`
+}
+
+// Sink writes audit events somewhere they are kept
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+}
+
+// Config holds the optional behavior of an Auditor
+type Config struct {
+	// Routes are always audited, they are the names given to Measure
+	Routes []string
+	// OnlyRoutes only audits Routes, otherwise every request that isn't a GET, HEAD or OPTIONS is audited too
+	OnlyRoutes bool
+	// BufferSize is how many events can wait to be written, defaults to 1000
+	BufferSize int
+	// BatchSize is the most events written to the sink at once, defaults to 100
+	BatchSize int
+	// FlushInterval is the longest an event waits before a partial batch is written, defaults to a second
+	FlushInterval time.Duration
+	// EnqueueTimeout is how long a request waits for room in a full buffer before its event is dropped,
+	// 0 drops it right away so a slow sink never slows down requests
+	EnqueueTimeout time.Duration
+	// WriteTimeout is how long the sink gets to write a batch before it's abandoned, defaults to 10 seconds
+	WriteTimeout time.Duration
+}
+
+// Auditor records audit events for requests and writes them to a sink in the background
+type Auditor struct {
+	sink   Sink
+	config Config
+	logger *logrus.Entry
+	routes map[string]bool
+
+	events chan Event
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+var recorderKey = contextkey.Of[*recorder](contextkey.ContextKeyAudit)
+
+// recorder is put in the context so the handler can add a diff to the event
+type recorder struct {
+	mu   sync.Mutex
+	diff json.RawMessage
+}
+
+// New creates an Auditor that writes to the sink until it's closed, a default logger is used when logger is nil
+func New(sink Sink, config Config, logger *logrus.Entry) *Auditor {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.New())
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultBufferSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+
+	routes := make(map[string]bool, len(config.Routes))
+	for _, route := range config.Routes {
+		routes[route] = true
+	}
+
+	a := &Auditor{
+		sink:   sink,
+		config: config,
+		logger: logger,
+		routes: routes,
+		events: make(chan Event, config.BufferSize),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+
+	return a
+}
+
+// Audit is the middleware that records an event for audited requests once they finish. It needs the claims
+// so it should be placed after Auth
+func (a *Auditor) Audit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := middleware.GetRouteNameFromCtx(r.Context())
+		if !a.audited(route, r.Method) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		loggingResponseWriter := lrw.Wrap(w)
+		rec := &recorder{}
+		ctx := recorderKey.WithValue(r.Context(), rec)
+		h.ServeHTTP(loggingResponseWriter, r.WithContext(ctx))
+
+		event := Event{
+			Time:   time.Now(),
+			Route:  route,
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Params: params(r),
+			Status: loggingResponseWriter.StatusCode,
+		}
+		event.RequestID, _ = middleware.GetRequestIDFromCtx(r.Context())
+		// only a verified identity is who made the request, an unverified one could be forged
+		identity := middleware.GetIdentityOrAnonymous(r.Context())
+		event.AuthMethod = string(identity.Method)
+		if identity.Verified {
+			event.UserID = identity.UserID
+			event.UserUUID = identity.UserUUID
+			event.APIKeyID = identity.APIKeyID
+		}
+		if claims, err := middleware.GetClaimsFromCtx(r.Context()); err == nil {
+			event.InitiatingUserID = claims.GetInitiatingUser()
+			event.InitiatingUserUUID = claims.GetInitiatingUserUUID()
+			event.Impersonated = event.InitiatingUserID > 0 && event.InitiatingUserID != event.UserID
+		}
+		rec.mu.Lock()
+		event.Diff = rec.diff
+		rec.mu.Unlock()
+
+		if err := a.Record(event); err != nil {
+			middleware.MustGetLoggerFromContext(r.Context()).WithError(err).Printf("Could not record audit event")
+		}
+	})
+}
+
+// SetDiff adds what the request changed to its audit event, diff is marshalled to json.
+// It does nothing for requests that aren't audited
+func SetDiff(ctx context.Context, diff interface{}) error {
+	rec, ok := recorderKey.Get(ctx)
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.diff = data
+	return nil
+}
+
+// Record queues the event to be written. When the buffer is full it waits up to EnqueueTimeout before dropping it
+func (a *Auditor) Record(event Event) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrClosed
+	}
+
+	select {
+	case a.events <- event:
+		return nil
+	default:
+	}
+
+	if a.config.EnqueueTimeout <= 0 {
+		return errors.New("audit buffer is full, event dropped")
+	}
+
+	timer := time.NewTimer(a.config.EnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case a.events <- event:
+		return nil
+	case <-timer.C:
+		return errors.New("audit buffer is full, event dropped")
+	}
+}
+
+// Close stops accepting events and returns once the queued events are written
+func (a *Auditor) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.events)
+	a.mu.Unlock()
+
+	<-a.done
+}
+
+func (a *Auditor) audited(route, method string) bool {
+	if a.routes[route] {
+		return true
+	}
+	if a.config.OnlyRoutes {
+		return false
+	}
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// run writes the events in batches, a partial batch is written after FlushInterval
+func (a *Auditor) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, a.config.BatchSize)
+	for {
+		select {
+		case event, ok := <-a.events:
+			if !ok {
+				a.write(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= a.config.BatchSize {
+				a.write(batch)
+				batch = make([]Event, 0, a.config.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				a.write(batch)
+				batch = make([]Event, 0, a.config.BatchSize)
+			}
+		}
+	}
+}
+
+func (a *Auditor) write(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+	// a hung sink would otherwise block the flusher and fill the buffer for good
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.WriteTimeout)
+	defer cancel()
+
+	if err := a.sink.Write(ctx, batch); err != nil {
+		a.logger.WithError(err).Errorf("Could not write %d audit events", len(batch))
+	}
+}
+
+// params returns the vestigo path parameters of the request
+func params(r *http.Request) map[string]string {
+	names := vestigo.TrimmedParamNames(r)
+	if len(names) == 0 {
+		return nil
+	}
+
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		params[name] = vestigo.Param(r, name)
+	}
+	return params
+}
@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/husobee/vestigo"
+	"github.com/justinas/alice"
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/chain"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/jwtdecode"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink keeps the events written to it, blocking until unblock is closed when it's set
+type memorySink struct {
+	mu      sync.Mutex
+	events  []Event
+	unblock chan struct{}
+}
+
+func (s *memorySink) Write(ctx context.Context, events []Event) error {
+	if s.unblock != nil {
+		<-s.unblock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+// staticToken validates any token with the same claims
+type staticToken struct {
+	claims auth.Claim
+}
+
+func (s staticToken) GenerateJWT(issuer string, userID int64, userUUID string, roles []string, permissions auth.Permission, duration time.Duration) (string, error) {
+	return "", nil
+}
+
+func (s staticToken) GenerateSystemToken(issuer string, initiatingUserID int64, duration time.Duration) (string, error) {
+	return "", nil
+}
+
+func (s staticToken) ValidateJWT(jwt string) (auth.Claim, error) {
+	return s.claims, nil
+}
+
+func TestUnit_Auditor_Audit(t *testing.T) {
+	sink := &memorySink{}
+	auditor := New(sink, Config{Routes: []string{"get secret"}, FlushInterval: time.Hour}, logrus.NewEntry(logrus.New()))
+
+	// an admin (user 1) impersonating user 7
+	claims := auth.NewClaim(nil, nil, nil, time.Now().Add(time.Hour), nil, nil, []string{auth.RoleUser}, 7, "user-uuid", 1, "admin-uuid", nil)
+
+	testCases := []struct {
+		route  string
+		method string
+	}{
+		{route: "update brand", method: http.MethodPut},
+		{route: "get brand", method: http.MethodGet},
+		{route: "get secret", method: http.MethodGet},
+	}
+
+	// installed as an extra like a service would, so the route name has to reach it through the chain
+	base := chain.NewBaseWithExtras(alice.New(), nil, nil, jwtdecode.NewJWTDecoder(), middleware.Auth(staticToken{claims: claims}), auditor.Audit)
+
+	for _, tc := range testCases {
+		handler := base.Measure(tc.route, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, SetDiff(r.Context(), map[string]string{"name": "new"}))
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		r := httptest.NewRequest(tc.method, "/brand/42", nil)
+		vestigo.AddParam(r, "brand_id", "42")
+		r.Header.Set("X-Request-Id", "request-1")
+		r.Header.Set("Authorization", "Bearer token")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	auditor.Close()
+	require.Equal(t, ErrClosed, auditor.Record(Event{}))
+
+	require.Len(t, sink.events, 2)
+	event := sink.events[0]
+	require.Equal(t, "update brand", event.Route)
+	require.Equal(t, "request-1", event.RequestID)
+	require.Equal(t, map[string]string{"brand_id": "42"}, event.Params)
+	require.Equal(t, http.StatusAccepted, event.Status)
+	require.Equal(t, int64(7), event.UserID)
+	require.Equal(t, "user-uuid", event.UserUUID)
+	require.Equal(t, int64(1), event.InitiatingUserID)
+	require.Equal(t, "admin-uuid", event.InitiatingUserUUID)
+	require.True(t, event.Impersonated)
+	require.Equal(t, "jwt", event.AuthMethod)
+	require.JSONEq(t, `{"name": "new"}`, string(event.Diff))
+	require.Equal(t, "get secret", sink.events[1].Route)
+}
+
+func TestUnit_Auditor_Backpressure(t *testing.T) {
+	sink := &memorySink{unblock: make(chan struct{})}
+	auditor := New(sink, Config{BufferSize: 1, BatchSize: 1, EnqueueTimeout: 10 * time.Millisecond}, logrus.NewEntry(logrus.New()))
+
+	// the first event is taken by the blocked sink, the second fills the buffer
+	require.NoError(t, auditor.Record(Event{Route: "1"}))
+	require.Eventually(t, func() bool { return len(auditor.events) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, auditor.Record(Event{Route: "2"}))
+	require.Error(t, auditor.Record(Event{Route: "3"}))
+
+	close(sink.unblock)
+	auditor.Close()
+	require.Len(t, sink.events, 2)
+}
+
+func TestUnit_FileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write(context.Background(), []Event{{Route: "a"}, {Route: "b"}}))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var routes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		routes = append(routes, event.Route)
+	}
+	require.Equal(t, []string{"a", "b"}, routes)
+}
+
+// hungSink never finishes a write on its own
+type hungSink struct{}
+
+func (hungSink) Write(ctx context.Context, events []Event) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestUnit_Auditor_WriteTimeout(t *testing.T) {
+	auditor := New(hungSink{}, Config{WriteTimeout: 10 * time.Millisecond}, logrus.NewEntry(logrus.New()))
+	require.NoError(t, auditor.Record(Event{Route: "a"}))
+
+	done := make(chan struct{})
+	go func() {
+		auditor.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on a hung sink")
+	}
+}
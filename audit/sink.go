@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/promoboxx/go-service/database/connector"
+	"github.com/sirupsen/logrus"
+)
+
+// Schema creates the table the postgres sink writes to
+const Schema = `CREATE TABLE IF NOT EXISTS audit_event (
+	id                   bigserial PRIMARY KEY,
+	time                 timestamptz NOT NULL,
+	request_id           text NOT NULL,
+	route                text NOT NULL,
+	method               text NOT NULL,
+	path                 text NOT NULL,
+	params               jsonb,
+	status               integer NOT NULL,
+	user_id              bigint NOT NULL,
+	user_uuid            text NOT NULL,
+	initiating_user_id   bigint NOT NULL,
+	initiating_user_uuid text NOT NULL,
+	impersonated         boolean NOT NULL,
+	auth_method          text NOT NULL,
+	api_key_id           text NOT NULL,
+	diff                 jsonb
+)`
+
+const insertEventColumns = `INSERT INTO audit_event (time, request_id, route, method, path, params, status, user_id, user_uuid, initiating_user_id, initiating_user_uuid, impersonated, auth_method, api_key_id, diff) VALUES `
+
+// eventColumns is the number of columns inserted for each event
+const eventColumns = 15
+
+// maxEventsPerInsert keeps each insert under the 65535 parameters postgres allows in a statement
+const maxEventsPerInsert = 65535 / eventColumns
+
+type loggerSink struct {
+	logger *logrus.Entry
+}
+
+// NewLoggerSink writes each event as a log entry with the event's fields
+func NewLoggerSink(logger *logrus.Entry) Sink {
+	return &loggerSink{logger: logger}
+}
+
+func (s *loggerSink) Write(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		s.logger.WithFields(logrus.Fields{
+			"audit.request_id":           event.RequestID,
+			"audit.route":                event.Route,
+			"audit.method":               event.Method,
+			"audit.path":                 event.Path,
+			"audit.params":               event.Params,
+			"audit.status":               event.Status,
+			"audit.user_id":              event.UserID,
+			"audit.user_uuid":            event.UserUUID,
+			"audit.initiating_user_id":   event.InitiatingUserID,
+			"audit.initiating_user_uuid": event.InitiatingUserUUID,
+			"audit.impersonated":         event.Impersonated,
+			"audit.auth_method":          event.AuthMethod,
+			"audit.api_key_id":           event.APIKeyID,
+			"audit.diff":                 string(event.Diff),
+		}).Printf("Audit event")
+	}
+	return nil
+}
+
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink appends each event to the file as a line of json
+func NewFileSink(path string) (Sink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit file: %v", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	encoder := json.NewEncoder(s.file)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("could not write audit event: %v", err)
+		}
+	}
+	return nil
+}
+
+type postgresSink struct {
+	connector connector.SQLDBConnector
+}
+
+// NewPostgresSink inserts the events into the audit_event table (see Schema)
+func NewPostgresSink(dbConnector connector.SQLDBConnector) Sink {
+	return &postgresSink{connector: dbConnector}
+}
+
+func (s *postgresSink) Write(ctx context.Context, events []Event) error {
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	for len(events) > 0 {
+		n := len(events)
+		if n > maxEventsPerInsert {
+			n = maxEventsPerInsert
+		}
+		if err := insertEvents(ctx, db, events[:n]); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+// insertEvents inserts the events with one statement
+func insertEvents(ctx context.Context, db *sql.DB, events []Event) error {
+
+	placeholders := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*eventColumns)
+	for i, event := range events {
+		params, err := json.Marshal(event.Params)
+		if err != nil {
+			return fmt.Errorf("could not marshal audit params: %v", err)
+		}
+		var diff interface{}
+		if len(event.Diff) > 0 {
+			diff = []byte(event.Diff)
+		}
+
+		values := make([]string, eventColumns)
+		for j := range values {
+			values[j] = fmt.Sprintf("$%d", i*eventColumns+j+1)
+		}
+		placeholders = append(placeholders, "("+strings.Join(values, ", ")+")")
+		args = append(args, event.Time, event.RequestID, event.Route, event.Method, event.Path, params, event.Status,
+			event.UserID, event.UserUUID, event.InitiatingUserID, event.InitiatingUserUUID, event.Impersonated,
+			event.AuthMethod, event.APIKeyID, diff)
+	}
+
+	if _, err := db.ExecContext(ctx, insertEventColumns+strings.Join(placeholders, ", "), args...); err != nil {
+		return fmt.Errorf("could not insert audit events: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-glitch/glitch"
+	"github.com/promoboxx/go-metric-client/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorDependencyUnavailable is the code of the error returned when a call is rejected
+const ErrorDependencyUnavailable = "DEPENDENCY_UNAVAILABLE"
+
+const (
+	metricDirection     = "outbound"
+	metricStateChange   = "circuit-breaker-state"
+	metricRejected      = "circuit-breaker-rejected"
+	windowBuckets       = 10
+	defaultWindow       = 10 * time.Second
+	defaultMinRequests  = 20
+	defaultThreshold    = 0.5
+	defaultOpenTimeout  = 30 * time.Second
+	defaultHalfOpenReqs = 1
+)
+
+var (
+	// ErrOpen is the inner error when the breaker is open
+	ErrOpen = errors.New("circuit breaker is open")
+	// ErrBulkheadFull is the inner error when the dependency already has the maximum number of calls in flight
+	ErrBulkheadFull = errors.New("too many concurrent calls")
+)
+
+// State of a breaker
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText allows states to be written as their name in JSON
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Config controls when a breaker opens and how many calls may run at once, zero values use the defaults
+type Config struct {
+	// Window is the rolling period the error rate is measured over, defaults to 10 seconds
+	Window time.Duration
+	// MinRequests is the number of calls in the window before the breaker can open, defaults to 20
+	MinRequests int
+	// ErrorThreshold is the fraction (0-1) of failed calls in the window that opens the breaker, defaults to 0.5
+	ErrorThreshold float64
+	// OpenTimeout is how long the breaker stays open before letting a trial call through, defaults to 30 seconds
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of trial calls that must succeed to close the breaker, defaults to 1
+	HalfOpenRequests int
+	// MaxConcurrent caps the calls in flight to the dependency, 0 means no cap
+	MaxConcurrent int
+}
+
+type bucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// Breaker stops calls to a dependency when too many of them fail, and caps how many can run at once
+type Breaker struct {
+	name          string
+	config        Config
+	logger        *logrus.Entry
+	metricsClient metrics.Client
+	bulkhead      chan struct{}
+
+	mu               sync.Mutex
+	state            State
+	openedAt         time.Time
+	buckets          [windowBuckets]bucket
+	halfOpenInFlight int
+	halfOpenPassed   int
+}
+
+// New creates a breaker for the named dependency, state changes are logged and reported when logger and metricsClient are not nil
+func New(name string, config Config, logger *logrus.Entry, metricsClient metrics.Client) *Breaker {
+	if config.Window <= 0 {
+		config.Window = defaultWindow
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = defaultMinRequests
+	}
+	if config.ErrorThreshold <= 0 {
+		config.ErrorThreshold = defaultThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultOpenTimeout
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = defaultHalfOpenReqs
+	}
+
+	b := &Breaker{name: name, config: config, logger: logger, metricsClient: metricsClient}
+	if config.MaxConcurrent > 0 {
+		b.bulkhead = make(chan struct{}, config.MaxConcurrent)
+	}
+
+	return b
+}
+
+// Name returns the name of the dependency
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkOpenTimeout(time.Now())
+	return b.state
+}
+
+// Execute runs fn if the breaker and bulkhead allow it and records the result. When the call is rejected
+// a transient DataError with the code ErrorDependencyUnavailable is returned without calling fn
+func (b *Breaker) Execute(fn func() error) error {
+	done, dataErr := b.Allow()
+	if dataErr != nil {
+		return dataErr
+	}
+
+	// a panic in fn counts as a failure so the reservation is always released
+	success := false
+	defer func() { done(success) }()
+
+	err := fn()
+	success = err == nil
+	return err
+}
+
+// outcome is the result of a call to the dependency
+type outcome int
+
+const (
+	outcomeFailure outcome = iota
+	outcomeSuccess
+	// outcomeNeutral releases the call without counting it, like when the caller gave up on it
+	outcomeNeutral
+)
+
+// Allow reserves a call to the dependency. If the call is allowed done must be called with
+// whether it succeeded, otherwise a DataError is returned
+func (b *Breaker) Allow() (done func(success bool), err glitch.DataError) {
+	release, err := b.reserve()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(success bool) {
+		if success {
+			release(outcomeSuccess)
+			return
+		}
+		release(outcomeFailure)
+	}, nil
+}
+
+// reserve is Allow with the outcome of the call, release must be called when the call is allowed
+func (b *Breaker) reserve() (release func(outcome), err glitch.DataError) {
+	if b.bulkhead != nil {
+		select {
+		case b.bulkhead <- struct{}{}:
+		default:
+			b.reportRejected("bulkhead")
+			return nil, glitch.NewTransientDataError(ErrBulkheadFull, ErrorDependencyUnavailable, fmt.Sprintf("%s is unavailable", b.name))
+		}
+	}
+
+	allowed, halfOpen := b.allow()
+	if !allowed {
+		if b.bulkhead != nil {
+			<-b.bulkhead
+		}
+		b.reportRejected("open")
+		return nil, glitch.NewTransientDataError(ErrOpen, ErrorDependencyUnavailable, fmt.Sprintf("%s is unavailable", b.name))
+	}
+
+	var once sync.Once
+	return func(result outcome) {
+		once.Do(func() {
+			b.record(result, halfOpen)
+			if b.bulkhead != nil {
+				<-b.bulkhead
+			}
+		})
+	}, nil
+}
+
+// allow returns whether a call may go through and whether it is a half-open trial call
+func (b *Breaker) allow() (bool, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkOpenTimeout(time.Now())
+
+	switch b.state {
+	case StateOpen:
+		return false, false
+	case StateHalfOpen:
+		if b.halfOpenInFlight+b.halfOpenPassed >= b.config.HalfOpenRequests {
+			return false, false
+		}
+		b.halfOpenInFlight++
+		return true, true
+	}
+
+	return true, false
+}
+
+// record adds the result of a call and changes state if needed, neutral results only free the call
+func (b *Breaker) record(result outcome, halfOpen bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	success := result == outcomeSuccess
+
+	if halfOpen {
+		b.halfOpenInFlight--
+		if b.state != StateHalfOpen || result == outcomeNeutral {
+			return
+		}
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.halfOpenPassed++
+		if b.halfOpenPassed >= b.config.HalfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+		return
+	}
+
+	if b.state != StateClosed || result == outcomeNeutral {
+		return
+	}
+
+	current := b.bucket(now)
+	current.requests++
+	if !success {
+		current.failures++
+	}
+
+	requests, failures := b.totals(now)
+	if requests >= b.config.MinRequests && float64(failures)/float64(requests) >= b.config.ErrorThreshold {
+		b.setState(StateOpen, now)
+	}
+}
+
+// checkOpenTimeout moves an open breaker to half-open once the open timeout has passed
+func (b *Breaker) checkOpenTimeout(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+// setState changes the state, resets the counters and reports the change
+func (b *Breaker) setState(state State, now time.Time) {
+	previous := b.state
+	b.state = state
+	b.halfOpenPassed = 0
+	b.buckets = [windowBuckets]bucket{}
+	if state == StateOpen {
+		b.openedAt = now
+	}
+
+	if b.logger != nil {
+		b.logger.WithFields(logrus.Fields{"dependency": b.name, "from": previous.String(), "to": state.String()}).
+			Warnf("Circuit breaker for %s changed from %s to %s", b.name, previous, state)
+	}
+	if b.metricsClient != nil {
+		b.metricsClient.ExternalCustom(metricDirection, b.name, "", metricStateChange, map[string]string{"state": state.String()}, 1)
+	}
+}
+
+// bucket returns the bucket for now, clearing it if it is left over from an earlier window
+func (b *Breaker) bucket(now time.Time) *bucket {
+	width := b.config.Window / windowBuckets
+	start := now.Truncate(width)
+	current := &b.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+// totals adds up the buckets that are still in the window
+func (b *Breaker) totals(now time.Time) (requests int, failures int) {
+	oldest := now.Add(-b.config.Window)
+	for _, bk := range b.buckets {
+		if bk.start.After(oldest) {
+			requests += bk.requests
+			failures += bk.failures
+		}
+	}
+	return requests, failures
+}
+
+func (b *Breaker) reportRejected(reason string) {
+	if b.metricsClient != nil {
+		b.metricsClient.ExternalCustom(metricDirection, b.name, "", metricRejected, map[string]string{"reason": reason}, 1)
+	}
+}
@@ -0,0 +1,104 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-glitch/glitch"
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = errors.New("failed")
+
+func TestUnit_Breaker(t *testing.T) {
+	b := New("test", Config{MinRequests: 4, ErrorThreshold: 0.5, OpenTimeout: 20 * time.Millisecond}, nil, nil)
+
+	require.NoError(t, b.Execute(func() error { return nil }))
+	require.NoError(t, b.Execute(func() error { return nil }))
+	require.Equal(t, errTest, b.Execute(func() error { return errTest }))
+	require.Equal(t, StateClosed, b.State())
+	require.Equal(t, errTest, b.Execute(func() error { return errTest }))
+	require.Equal(t, StateOpen, b.State())
+
+	called := false
+	err := b.Execute(func() error { called = true; return nil })
+	require.False(t, called)
+	dataErr, ok := err.(glitch.DataError)
+	require.True(t, ok)
+	require.Equal(t, ErrorDependencyUnavailable, dataErr.Code())
+	require.True(t, dataErr.IsTransient())
+
+	require.Eventually(t, func() bool { return b.State() == StateHalfOpen }, time.Second, 5*time.Millisecond)
+	require.Equal(t, errTest, b.Execute(func() error { return errTest }))
+	require.Equal(t, StateOpen, b.State())
+
+	require.Eventually(t, func() bool { return b.State() == StateHalfOpen }, time.Second, 5*time.Millisecond)
+	require.NoError(t, b.Execute(func() error { return nil }))
+	require.Equal(t, StateClosed, b.State())
+}
+
+func TestUnit_Bulkhead(t *testing.T) {
+	b := New("test", Config{MaxConcurrent: 1}, nil, nil)
+
+	done, err := b.Allow()
+	require.Nil(t, err)
+
+	_, err = b.Allow()
+	require.NotNil(t, err)
+	require.Equal(t, ErrBulkheadFull, err.Inner())
+
+	done(true)
+	done, err = b.Allow()
+	require.Nil(t, err)
+	done(true)
+}
+
+func TestUnit_Breaker_Panic(t *testing.T) {
+	b := New("test", Config{MinRequests: 1, ErrorThreshold: 0.5, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 1}, nil, nil)
+	require.Equal(t, errTest, b.Execute(func() error { return errTest }))
+	require.Eventually(t, func() bool { return b.State() == StateHalfOpen }, time.Second, 5*time.Millisecond)
+
+	// the panicking trial call is a failure, it doesn't leave the half-open slot taken
+	require.Panics(t, func() { b.Execute(func() error { panic("boom") }) })
+	require.Equal(t, StateOpen, b.State())
+
+	require.Eventually(t, func() bool { return b.State() == StateHalfOpen }, time.Second, 5*time.Millisecond)
+	require.NoError(t, b.Execute(func() error { return nil }))
+	require.Equal(t, StateClosed, b.State())
+}
+
+func TestUnit_Transport_CallerCanceled(t *testing.T) {
+	b := New("test", Config{MinRequests: 1, ErrorThreshold: 0.5}, nil, nil)
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewTransport(b, base).RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, StateClosed, b.State())
+
+	_, err = NewTransport(b, base).RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestUnit_Registry_RequiresAdmin(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewRegistry(nil, nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/breakers", nil))
+
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
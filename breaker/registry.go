@@ -0,0 +1,76 @@
+package breaker
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/promoboxx/go-metric-client/metrics"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/service"
+	"github.com/sirupsen/logrus"
+)
+
+// Registry keeps one breaker per dependency so their states can be looked up together
+type Registry struct {
+	logger        *logrus.Entry
+	metricsClient metrics.Client
+
+	mu       sync.RWMutex
+	breakers map[string]*Breaker
+}
+
+// BreakerState is the admin route representation of a breaker
+type BreakerState struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+}
+
+// NewRegistry creates a registry whose breakers log and report through logger and metricsClient
+func NewRegistry(logger *logrus.Entry, metricsClient metrics.Client) *Registry {
+	return &Registry{logger: logger, metricsClient: metricsClient, breakers: map[string]*Breaker{}}
+}
+
+// Get returns the breaker for the dependency, creating it with config if it does not exist yet
+func (r *Registry) Get(name string, config Config) *Breaker {
+	r.mu.RLock()
+	b, ok := r.breakers[name]
+	r.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok = r.breakers[name] // check to make sure something didn't just create it
+	if ok {
+		return b
+	}
+
+	b = New(name, config, r.logger, r.metricsClient)
+	r.breakers[name] = b
+	return b
+}
+
+// States returns the state of every breaker sorted by name
+func (r *Registry) States() []BreakerState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	states := make([]BreakerState, 0, len(r.breakers))
+	for name, b := range r.breakers {
+		states = append(states, BreakerState{Name: name, State: b.State()})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+
+	return states
+}
+
+// ServeHTTP writes the breaker states as JSON. It requires admin claims so it should be placed behind middleware.Auth
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	middleware.AdminOnly(http.HandlerFunc(r.serveStates)).ServeHTTP(w, req)
+}
+
+func (r *Registry) serveStates(w http.ResponseWriter, req *http.Request) {
+	service.WriteJSONResponse(w, http.StatusOK, r.States())
+}
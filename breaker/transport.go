@@ -0,0 +1,40 @@
+package breaker
+
+import (
+	"net/http"
+)
+
+type transport struct {
+	breaker *Breaker
+	base    http.RoundTripper
+}
+
+// NewTransport wraps base so every request goes through the breaker. Transport errors and 5xx
+// responses count as failures, errors from the request's own context being done don't count at all.
+// If base is nil http.DefaultTransport is used
+func NewTransport(b *Breaker, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{breaker: b, base: base}
+}
+
+// RoundTrip sends the request if the breaker allows it
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, dataErr := t.breaker.reserve()
+	if dataErr != nil {
+		return nil, dataErr
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// the caller canceled or timed out, that says nothing about the dependency
+		release(outcomeNeutral)
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		release(outcomeFailure)
+	default:
+		release(outcomeSuccess)
+	}
+	return resp, err
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/promoboxx/go-discovery/src/discovery"
+	"github.com/promoboxx/go-glitch/glitch"
+	"github.com/promoboxx/go-metric-client/metrics"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/transport"
+)
+
+// error codes returned by the client when there is no problem from the other service
+const (
+	ErrorServiceDiscovery = "ERROR_SERVICE_DISCOVERY"
+	ErrorEncodingRequest  = "ERROR_ENCODING_REQUEST"
+	ErrorRequest          = "ERROR_REQUEST"
+	ErrorDecodingResponse = "ERROR_DECODING_RESPONSE"
+)
+
+const metricDirection = "outbound"
+
+// Client sends JSON requests to another service
+type Client interface {
+	// Do sends the request and decodes a successful response into result, if result is not nil.
+	// Non-2xx responses are returned as a DataError built from the HTTPProblem in the body
+	Do(ctx context.Context, req Request, result interface{}) glitch.DataError
+	Get(ctx context.Context, path string, result interface{}) glitch.DataError
+	Post(ctx context.Context, path string, body, result interface{}) glitch.DataError
+	Put(ctx context.Context, path string, body, result interface{}) glitch.DataError
+	Delete(ctx context.Context, path string, result interface{}) glitch.DataError
+}
+
+// Request describes a call to the service
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	// Body is marshalled to JSON, a []byte is sent as is
+	Body interface{}
+	// Name is used instead of Path when reporting metrics so IDs in the path don't create new metrics
+	Name string
+	// Idempotent allows a request that is not a GET, HEAD, PUT, DELETE or OPTIONS to be retried on failure
+	Idempotent bool
+}
+
+// Config holds the optional settings for a client
+type Config struct {
+	// UseTLS sends requests over https
+	UseTLS bool
+	// Timeout of each attempt, defaults to 30 seconds
+	Timeout time.Duration
+	// MaxRetries is the number of times a failed request may be retried
+	MaxRetries int
+	// BaseBackoff is the starting wait between retries, defaults to 100ms
+	BaseBackoff time.Duration
+	// MaxBackoff caps the wait between retries, defaults to 5 seconds
+	MaxBackoff time.Duration
+	// Transport is wrapped with context propagation, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+type client struct {
+	serviceName   string
+	finder        discovery.Finder
+	metricsClient metrics.Client
+	config        Config
+	httpClient    *http.Client
+}
+
+// New creates a client for the service, the host is found through the finder for every request
+//
+// Expected usage:
+// c := client.New("user-service", finder, metricsClient, client.Config{MaxRetries: 2})
+// var u User
+// err := c.Get(r.Context(), "/user/1", &u)
+func New(serviceName string, finder discovery.Finder, metricsClient metrics.Client, config Config) Client {
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = 100 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 5 * time.Second
+	}
+
+	return &client{
+		serviceName:   serviceName,
+		finder:        finder,
+		metricsClient: metricsClient,
+		config:        config,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+			// the JWT is forwarded by the client itself since discovered hosts are always internal
+			Transport: transport.NewPropagatingTransport(config.Transport, nil),
+		},
+	}
+}
+
+func (c *client) Get(ctx context.Context, path string, result interface{}) glitch.DataError {
+	return c.Do(ctx, Request{Method: http.MethodGet, Path: path}, result)
+}
+
+func (c *client) Post(ctx context.Context, path string, body, result interface{}) glitch.DataError {
+	return c.Do(ctx, Request{Method: http.MethodPost, Path: path, Body: body}, result)
+}
+
+func (c *client) Put(ctx context.Context, path string, body, result interface{}) glitch.DataError {
+	return c.Do(ctx, Request{Method: http.MethodPut, Path: path, Body: body}, result)
+}
+
+func (c *client) Delete(ctx context.Context, path string, result interface{}) glitch.DataError {
+	return c.Do(ctx, Request{Method: http.MethodDelete, Path: path}, result)
+}
+
+func (c *client) Do(ctx context.Context, req Request, result interface{}) glitch.DataError {
+	metricPath := req.Name
+	if metricPath == "" {
+		metricPath = req.Path
+	}
+
+	body, err := encodeBody(req.Body)
+	if err != nil {
+		return glitch.NewDataError(err, ErrorEncodingRequest, "Could not encode request body")
+	}
+
+	var dataErr glitch.DataError
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		var retryable bool
+		dataErr, retryable = c.attempt(ctx, req, body, result)
+		c.report(metricPath, time.Since(start), dataErr)
+
+		if dataErr == nil || !retryable || attempt >= c.config.MaxRetries {
+			return dataErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return dataErr
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// attempt sends the request once and returns whether a failure may be retried
+func (c *client) attempt(ctx context.Context, req Request, body []byte, result interface{}) (glitch.DataError, bool) {
+	idempotent := req.Idempotent || isIdempotent(req.Method)
+
+	u, err := c.url(req)
+	if err != nil {
+		return glitch.NewTransientDataError(err, ErrorServiceDiscovery, fmt.Sprintf("Could not find %s", c.serviceName)), true
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, u, reader)
+	if err != nil {
+		return glitch.NewDataError(err, ErrorRequest, "Could not create request"), false
+	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = v
+	}
+	if body != nil && httpReq.Header.Get("Content-Type") == "" {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if jwt, err := middleware.GetJWTFromCtx(ctx); err == nil && jwt != "" && httpReq.Header.Get("Authorization") == "" {
+		httpReq.Header.Set("Authorization", jwt)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return glitch.NewTransientDataError(err, ErrorRequest, fmt.Sprintf("Could not call %s", c.serviceName)), idempotent && ctx.Err() == nil
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return glitch.NewTransientDataError(err, ErrorRequest, fmt.Sprintf("Could not read response from %s", c.serviceName)), idempotent
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		dataErr := decodeProblem(resp.StatusCode, respBody, fmt.Sprintf("Error from %s", c.serviceName))
+		return dataErr, dataErr.IsTransient() || (idempotent && resp.StatusCode >= http.StatusInternalServerError)
+	}
+
+	if result != nil && len(respBody) > 0 {
+		err = json.Unmarshal(respBody, result)
+		if err != nil {
+			return glitch.NewDataError(err, ErrorDecodingResponse, fmt.Sprintf("Could not decode response from %s", c.serviceName)), false
+		}
+	}
+
+	return nil, false
+}
+
+// url finds the service and builds the full url of the request
+func (c *client) url(req Request) (string, error) {
+	host, port, err := c.finder.FindHostPort(c.serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(int(port))), Path: req.Path}
+	if c.config.UseTLS {
+		u.Scheme = "https"
+	}
+	if len(req.Query) > 0 {
+		u.RawQuery = req.Query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// backoff returns a random wait up to the exponential backoff for the attempt
+func (c *client) backoff(attempt int) time.Duration {
+	ceiling := c.config.MaxBackoff
+	if attempt < 30 {
+		if exp := c.config.BaseBackoff << uint(attempt); exp > 0 && exp < ceiling {
+			ceiling = exp
+		}
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func (c *client) report(path string, duration time.Duration, dataErr glitch.DataError) {
+	if c.metricsClient == nil {
+		return
+	}
+
+	c.metricsClient.ExternalRate(metricDirection, c.serviceName, path, 1)
+	c.metricsClient.ExternalDuration(metricDirection, c.serviceName, path, duration)
+	if dataErr != nil {
+		c.metricsClient.ExternalError(metricDirection, c.serviceName, path, dataErr.Code(), dataErr.Msg(), 1)
+	}
+}
+
+// decodeProblem turns an error response into a DataError, responses without a problem body
+// are treated as transient when the service is unavailable
+func decodeProblem(status int, body []byte, msg string) glitch.DataError {
+	prob := glitch.HTTPProblemMetadata{}
+	err := json.Unmarshal(body, &prob)
+	if err != nil || prob.Code == "" {
+		return glitch.FromHTTPProblem(glitch.HTTPProblem{
+			Title:       http.StatusText(status),
+			Status:      status,
+			Detail:      string(body),
+			Code:        glitch.UnknownCode,
+			IsTransient: status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout,
+		}, msg)
+	}
+
+	if prob.Status == 0 {
+		prob.Status = status
+	}
+	if prob.Metadata == nil {
+		return glitch.FromHTTPProblem(prob.HTTPProblem, msg)
+	}
+	return glitch.FromHTTPProblem(prob, msg)
+}
+
+func encodeBody(body interface{}) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	if by, ok := body.([]byte); ok {
+		return by, nil
+	}
+
+	return json.Marshal(body)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-glitch/glitch"
+	"github.com/promoboxx/go-service/service"
+	"github.com/stretchr/testify/require"
+)
+
+type testFinder struct {
+	host string
+	port uint16
+}
+
+func (f *testFinder) FindService(name string) (string, error) {
+	return "http://" + net.JoinHostPort(f.host, strconv.Itoa(int(f.port))), nil
+}
+
+func (f *testFinder) FindHostPort(name string) (string, uint16, error) {
+	return f.host, f.port, nil
+}
+
+func newTestClient(t *testing.T, h http.HandlerFunc) Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	return New("test-service", &testFinder{host: host, port: uint16(p)}, nil, Config{MaxRetries: 2, BaseBackoff: time.Millisecond})
+}
+
+func TestUnit_Client_Do(t *testing.T) {
+	tests := map[string]struct {
+		request  Request
+		handler  func(calls int) http.HandlerFunc
+		validate func(t *testing.T, calls int, result map[string]string, err glitch.DataError)
+	}{
+		"success decodes the body": {
+			request: Request{Method: http.MethodGet, Path: "/thing"},
+			handler: func(calls int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					service.WriteJSONResponse(w, http.StatusOK, map[string]string{"name": "thing"})
+				}
+			},
+			validate: func(t *testing.T, calls int, result map[string]string, err glitch.DataError) {
+				require.Nil(t, err)
+				require.Equal(t, 1, calls)
+				require.Equal(t, "thing", result["name"])
+			},
+		},
+		"problem is decoded into a data error": {
+			request: Request{Method: http.MethodPost, Path: "/thing", Body: map[string]string{"name": "thing"}},
+			handler: func(calls int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					service.WriteProblem(w, "bad thing", "BAD_THING", http.StatusBadRequest, nil)
+				}
+			},
+			validate: func(t *testing.T, calls int, result map[string]string, err glitch.DataError) {
+				require.NotNil(t, err)
+				require.Equal(t, "BAD_THING", err.Code())
+				require.Equal(t, 1, calls)
+			},
+		},
+		"idempotent request is retried on server errors": {
+			request: Request{Method: http.MethodGet, Path: "/thing"},
+			handler: func(calls int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					if calls < 3 {
+						service.WriteProblem(w, "broken", "BROKEN", http.StatusInternalServerError, nil)
+						return
+					}
+					service.WriteJSONResponse(w, http.StatusOK, map[string]string{"name": "thing"})
+				}
+			},
+			validate: func(t *testing.T, calls int, result map[string]string, err glitch.DataError) {
+				require.Nil(t, err)
+				require.Equal(t, 3, calls)
+			},
+		},
+		"non-idempotent request is not retried unless transient": {
+			request: Request{Method: http.MethodPost, Path: "/thing"},
+			handler: func(calls int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					service.WriteProblem(w, "broken", "BROKEN", http.StatusInternalServerError, nil)
+				}
+			},
+			validate: func(t *testing.T, calls int, result map[string]string, err glitch.DataError) {
+				require.NotNil(t, err)
+				require.Equal(t, 1, calls)
+			},
+		},
+		"transient problem is retried": {
+			request: Request{Method: http.MethodPost, Path: "/thing"},
+			handler: func(calls int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					service.WriteProblem(w, "busy", "BUSY", http.StatusConflict, glitch.NewTransientDataError(nil, "BUSY", "busy"))
+				}
+			},
+			validate: func(t *testing.T, calls int, result map[string]string, err glitch.DataError) {
+				require.NotNil(t, err)
+				require.True(t, err.IsTransient())
+				require.Equal(t, 3, calls)
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				tc.handler(calls)(w, r)
+			})
+
+			result := map[string]string{}
+			err := c.Do(context.Background(), tc.request, &result)
+			tc.validate(t, calls, result, err)
+		})
+	}
+}
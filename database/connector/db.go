@@ -1,7 +1,7 @@
 package connector
 
 import (
-	"context"
+	"database/sql"
 	"net/http"
 
 	"github.com/promoboxx/go-service/alice/middleware/contextkey"
@@ -17,7 +17,7 @@ func InjectDBConn(connector SQLDBConnector) func(http.Handler) http.Handler {
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), contextkey.ContextKeyDBConn, dbConn)
+			ctx := contextkey.Of[*sql.DB](contextkey.ContextKeyDBConn).WithValue(r.Context(), dbConn)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/promoboxx/go-service/prom"
+)
+
+// RegisterPoolMetrics adds the sql.DBStats of every pooled connection to the registry, they are read each time it is scraped
+func RegisterPoolMetrics(registry *prom.Registry) {
+	maxOpen := registry.NewGauge("db_pool_max_open_connections", "Maximum number of open connections to the database.", "db", "host")
+	open := registry.NewGauge("db_pool_open_connections", "Established connections, both in use and idle.", "db", "host")
+	inUse := registry.NewGauge("db_pool_in_use_connections", "Connections currently in use.", "db", "host")
+	idle := registry.NewGauge("db_pool_idle_connections", "Idle connections.", "db", "host")
+	waitCount := registry.NewCounter("db_pool_wait_count_total", "Connections waited for.", "db", "host")
+	waitDuration := registry.NewCounter("db_pool_wait_duration_seconds_total", "Time spent waiting for new connections.", "db", "host")
+	maxIdleClosed := registry.NewCounter("db_pool_max_idle_closed_total", "Connections closed due to the idle connection limit.", "db", "host")
+	maxLifetimeClosed := registry.NewCounter("db_pool_max_lifetime_closed_total", "Connections closed due to the max lifetime limit.", "db", "host")
+
+	gauges := []*prom.Gauge{maxOpen, open, inUse, idle}
+	counters := []*prom.Counter{waitCount, waitDuration, maxIdleClosed, maxLifetimeClosed}
+
+	// the pools reported by the last scrape, their series are dropped once they are gone from connMap
+	var mu sync.Mutex
+	reported := map[[2]string]bool{}
+
+	registry.AddCollector(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		mapLock.RLock()
+		defer mapLock.RUnlock()
+
+		current := make(map[[2]string]bool, len(connMap))
+		for key, db := range connMap {
+			dbName, host := poolLabels(key)
+			current[[2]string{dbName, host}] = true
+			stats := db.Stats()
+
+			maxOpen.Set(float64(stats.MaxOpenConnections), dbName, host)
+			open.Set(float64(stats.OpenConnections), dbName, host)
+			inUse.Set(float64(stats.InUse), dbName, host)
+			idle.Set(float64(stats.Idle), dbName, host)
+			waitCount.Set(float64(stats.WaitCount), dbName, host)
+			waitDuration.Set(stats.WaitDuration.Seconds(), dbName, host)
+			maxIdleClosed.Set(float64(stats.MaxIdleClosed), dbName, host)
+			maxLifetimeClosed.Set(float64(stats.MaxLifetimeClosed), dbName, host)
+		}
+
+		for labels := range reported {
+			if current[labels] {
+				continue
+			}
+			for _, gauge := range gauges {
+				gauge.Delete(labels[0], labels[1])
+			}
+			for _, counter := range counters {
+				counter.Delete(labels[0], labels[1])
+			}
+		}
+		reported = current
+	})
+}
+
+// poolLabels gets the database name and host out of a connMap key without the credentials
+func poolLabels(key string) (string, string) {
+	conn := key
+	if i := strings.Index(key, "|"); i >= 0 {
+		conn = key[i+1:]
+	}
+
+	u, err := url.Parse(conn)
+	if err != nil {
+		return "unknown", "unknown"
+	}
+
+	return strings.TrimPrefix(u.Path, "/"), u.Host
+}
@@ -0,0 +1,34 @@
+package connector
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+
+	"github.com/promoboxx/go-service/prom"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_RegisterPoolMetrics_RemovedPool(t *testing.T) {
+	key := "postgres|postgres://db.internal:5432/brands"
+	mapLock.Lock()
+	connMap[key] = &sql.DB{}
+	mapLock.Unlock()
+
+	registry := prom.NewRegistry()
+	RegisterPoolMetrics(registry)
+
+	buf := &bytes.Buffer{}
+	_, err := registry.WriteTo(buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `db_pool_open_connections{db="brands",host="db.internal:5432"} 0`)
+
+	mapLock.Lock()
+	delete(connMap, key)
+	mapLock.Unlock()
+
+	buf.Reset()
+	_, err = registry.WriteTo(buf)
+	require.NoError(t, err)
+	require.NotContains(t, buf.String(), "brands")
+}
@@ -0,0 +1,62 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/promoboxx/go-service/producer"
+)
+
+// Schema creates the outbox table, events stay in it once delivered or dead lettered until DeleteDelivered removes them
+const Schema = `CREATE TABLE IF NOT EXISTS outbox_event (
+	id              bigserial PRIMARY KEY,
+	topic           text NOT NULL,
+	key             text NOT NULL DEFAULT '',
+	headers         jsonb NOT NULL DEFAULT '{}',
+	payload         bytea NOT NULL,
+	created_at      timestamptz NOT NULL DEFAULT now(),
+	attempts        integer NOT NULL DEFAULT 0,
+	next_attempt_at timestamptz NOT NULL DEFAULT now(),
+	last_error      text,
+	delivered_at    timestamptz,
+	dead_at         timestamptz
+);
+CREATE INDEX IF NOT EXISTS outbox_event_pending_idx ON outbox_event (next_attempt_at, id)
+	WHERE delivered_at IS NULL AND dead_at IS NULL`
+
+const insertEvent = `INSERT INTO outbox_event (topic, key, headers, payload) VALUES ($1, $2, $3, $4)`
+
+// Event is a message to publish once the transaction it was enqueued in commits
+type Event struct {
+	Topic   string
+	Key     string
+	Headers map[string]string
+	Payload []byte
+}
+
+// Execer runs a statement, it's normally the *sql.Tx the rest of the changes are written in
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue writes the event to the outbox table with tx, so it's only published if the transaction commits.
+// The request ID, trace context and canary version of ctx are added to the headers since the event is
+// published later by the Relay, away from the request
+func Enqueue(ctx context.Context, tx Execer, event Event) error {
+	headers, err := json.Marshal(producer.PropagatedHeaders(ctx, event.Headers))
+	if err != nil {
+		return fmt.Errorf("could not marshal outbox headers: %v", err)
+	}
+
+	payload := event.Payload
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	if _, err := tx.ExecContext(ctx, insertEvent, event.Topic, event.Key, headers, payload); err != nil {
+		return fmt.Errorf("could not enqueue outbox event: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecer records the statements run with it
+type fakeExecer struct {
+	queries []string
+	args    [][]interface{}
+}
+
+func (f *fakeExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+	return nil, nil
+}
+
+type publisherFunc func(topic string) error
+
+func (f publisherFunc) Publish(ctx context.Context, topic, key string, headers map[string]string, payload []byte) error {
+	return f(topic)
+}
+
+func TestUnit_Enqueue(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextkey.ContextKeyRequestID, "request-1")
+	tx := &fakeExecer{}
+
+	require.NoError(t, Enqueue(ctx, tx, Event{Topic: "brand.updated", Key: "42", Headers: map[string]string{"a": "b"}, Payload: []byte(`{"id":42}`)}))
+
+	require.Equal(t, []string{insertEvent}, tx.queries)
+	args := tx.args[0]
+	require.Equal(t, "brand.updated", args[0])
+	require.Equal(t, "42", args[1])
+	var headers map[string]string
+	require.NoError(t, json.Unmarshal(args[2].([]byte), &headers))
+	require.Equal(t, map[string]string{"a": "b", "X-Request-Id": "request-1"}, headers)
+	require.Equal(t, []byte(`{"id":42}`), args[3])
+}
+
+func TestUnit_Relay_Outcomes(t *testing.T) {
+	publisher := publisherFunc(func(topic string) error {
+		if topic == "broken" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	relay := NewRelay(nil, publisher, RelayConfig{MaxAttempts: 3}, logrus.NewEntry(logrus.New()))
+
+	testCases := []struct {
+		name          string
+		event         pendingEvent
+		expectedQuery string
+	}{
+		{
+			name:          "published",
+			event:         pendingEvent{id: 1, attempts: 1, Event: Event{Topic: "brand.updated"}},
+			expectedQuery: markDelivered,
+		},
+		{
+			name:          "retried",
+			event:         pendingEvent{id: 2, attempts: 1, Event: Event{Topic: "broken"}},
+			expectedQuery: markFailed,
+		},
+		{
+			name:          "dead lettered after max attempts",
+			event:         pendingEvent{id: 3, attempts: 3, Event: Event{Topic: "broken"}},
+			expectedQuery: markDead,
+		},
+		{
+			// the claim counts the attempt, so an event whose last publish never finished isn't published again
+			name:          "dead lettered after an abandoned attempt",
+			event:         pendingEvent{id: 4, attempts: 4, Event: Event{Topic: "brand.updated"}},
+			expectedQuery: markDead,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := &fakeExecer{}
+			require.NoError(t, relay.relay(context.Background(), tx, tc.event))
+			require.Equal(t, []string{tc.expectedQuery}, tx.queries)
+			require.Equal(t, tc.event.id, tx.args[0][0])
+		})
+	}
+}
+
+func TestUnit_Backoff(t *testing.T) {
+	testCases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: time.Second},
+		{attempts: 2, expected: 2 * time.Second},
+		{attempts: 4, expected: 8 * time.Second},
+		{attempts: 20, expected: time.Minute},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, backoff(tc.attempts, time.Second, time.Minute))
+	}
+}
+
+func TestUnit_Truncate(t *testing.T) {
+	testCases := []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{s: "short", n: 10, expected: "short"},
+		{s: "broker unavailable", n: 6, expected: "broker"},
+		// é is two bytes, cutting after its first byte would leave invalid UTF-8
+		{s: "café", n: 4, expected: "caf"},
+		{s: "café", n: 5, expected: "café"},
+	}
+
+	for _, tc := range testCases {
+		require.Equal(t, tc.expected, truncate(tc.s, tc.n))
+	}
+}
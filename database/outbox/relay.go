@@ -0,0 +1,329 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"github.com/promoboxx/go-metric-client/metrics"
+	"github.com/promoboxx/go-service/database/connector"
+	"github.com/promoboxx/go-service/producer"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize      = 100
+	defaultPollInterval   = time.Second
+	defaultMaxAttempts    = 10
+	defaultMinBackoff     = time.Second
+	defaultMaxBackoff     = 10 * time.Minute
+	defaultPublishTimeout = 10 * time.Second
+	// defaultLeaseMargin is added to the time a whole batch can take to publish for recording the outcomes
+	defaultLeaseMargin = time.Minute
+
+	maxErrorLength = 1000
+	// errAbandoned is the last error of events whose final attempt never finished
+	errAbandoned = "the lease ran out before the publish finished"
+
+	logFieldEventID = "outbox_event_id"
+	logFieldTopic   = "topic"
+
+	metricOriginatingService = "outbox"
+	metricPublished          = "outbox-published"
+	metricFailed             = "outbox-failed"
+	metricDeadLettered       = "outbox-dead-lettered"
+)
+
+const (
+	// claimEvents leases the due events by moving their next attempt past the lease and counts the attempt, so
+	// an event whose publish never finishes is still dead lettered. Rows locked by another relay are skipped so
+	// relays can run on every instance, and the lock is only held for this statement
+	claimEvents = `UPDATE outbox_event SET next_attempt_at = now() + $2::bigint * interval '1 millisecond', attempts = attempts + 1
+	WHERE id IN (
+		SELECT id FROM outbox_event
+		WHERE delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, topic, key, headers, payload, attempts`
+
+	// the outcomes leave events that are already delivered or dead alone, in case the lease ran out and
+	// another relay got to the event first
+	markDelivered = `UPDATE outbox_event SET delivered_at = now(), last_error = NULL
+	WHERE id = $1 AND delivered_at IS NULL AND dead_at IS NULL`
+
+	markFailed = `UPDATE outbox_event SET next_attempt_at = $2, last_error = $3
+	WHERE id = $1 AND delivered_at IS NULL AND dead_at IS NULL`
+
+	markDead = `UPDATE outbox_event SET dead_at = now(), last_error = $2
+	WHERE id = $1 AND delivered_at IS NULL AND dead_at IS NULL`
+
+	deleteDelivered = `DELETE FROM outbox_event WHERE delivered_at IS NOT NULL AND delivered_at < $1`
+
+	purgeDead = `DELETE FROM outbox_event WHERE dead_at IS NOT NULL AND dead_at < $1`
+
+	requeueDead = `UPDATE outbox_event SET dead_at = NULL, attempts = 0, next_attempt_at = now(), last_error = NULL
+	WHERE dead_at IS NOT NULL AND id = ANY($1)`
+)
+
+// RelayConfig holds the optional behavior of a Relay
+type RelayConfig struct {
+	// BatchSize is the most events claimed at once, defaults to 100
+	BatchSize int
+	// PollInterval is how long the relay waits for new events when the outbox is empty, defaults to a second
+	PollInterval time.Duration
+	// MaxAttempts is how many times an event is published before it's dead lettered, defaults to 10
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry, it doubles with each attempt up to MaxBackoff.
+	// They default to a second and 10 minutes
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// PublishTimeout is how long each publish can take before it counts as failed, defaults to 10 seconds
+	PublishTimeout time.Duration
+	// Lease is how long claimed events are hidden from other relays while they are published, events whose
+	// outcome wasn't recorded are published again after it. It should be longer than a batch can take to publish,
+	// defaults to BatchSize times PublishTimeout plus a minute
+	Lease time.Duration
+	// MetricsClient reports published, failed and dead lettered events by topic when set
+	MetricsClient metrics.Client
+}
+
+// Relay publishes the events in the outbox table. Events are delivered at least once, an event can be published
+// again if the relay stops before its outcome is recorded
+type Relay struct {
+	connector connector.SQLDBConnector
+	publisher producer.Producer
+	config    RelayConfig
+	logger    *logrus.Entry
+}
+
+// pendingEvent is an event claimed from the outbox, attempts includes the claim
+type pendingEvent struct {
+	id       int64
+	attempts int
+	Event
+}
+
+// NewRelay creates a Relay that publishes with publisher, Run starts it. A default logger is used when logger is nil
+func NewRelay(dbConnector connector.SQLDBConnector, publisher producer.Producer, config RelayConfig, logger *logrus.Entry) *Relay {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.New())
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = defaultMaxBackoff
+	}
+	if config.PublishTimeout <= 0 {
+		config.PublishTimeout = defaultPublishTimeout
+	}
+	if config.Lease <= 0 {
+		config.Lease = time.Duration(config.BatchSize)*config.PublishTimeout + defaultLeaseMargin
+	}
+
+	return &Relay{connector: dbConnector, publisher: publisher, config: config, logger: logger}
+}
+
+// Run relays events until ctx is done. Full batches are followed by the next one right away, otherwise it
+// waits PollInterval for more events
+func (r *Relay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait := r.config.PollInterval
+		relayed, err := r.RelayBatch(ctx)
+		if err != nil {
+			r.logger.WithError(err).Errorf("Could not relay outbox events")
+		} else if relayed == r.config.BatchSize {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+// RelayBatch leases a batch of due events, publishes them and records the outcome of each one as it's known.
+// No transaction is held while publishing. It returns how many events were claimed
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	db, err := r.connector.GetConnection()
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := claim(ctx, db, r.config.BatchSize, r.config.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	// an outcome that couldn't be recorded only gets its event published again once the lease is up,
+	// so keep going with the rest of the batch
+	var firstErr error
+	for _, event := range events {
+		if err := r.relay(ctx, db, event); err != nil {
+			r.logger.WithError(err).WithField(logFieldEventID, event.id).Errorf("Could not record outbox event outcome")
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return len(events), firstErr
+}
+
+// DeleteDelivered removes the events delivered before olderThan, it can be run periodically to keep the table
+// small. Dead lettered events are kept, see PurgeDead
+func (r *Relay) DeleteDelivered(ctx context.Context, olderThan time.Time) error {
+	return r.exec(ctx, "could not delete delivered outbox events", deleteDelivered, olderThan)
+}
+
+// PurgeDead removes the events dead lettered before olderThan, they can't be requeued once they are purged
+func (r *Relay) PurgeDead(ctx context.Context, olderThan time.Time) error {
+	return r.exec(ctx, "could not purge dead outbox events", purgeDead, olderThan)
+}
+
+// Requeue makes the dead lettered events with the ids due again, with their attempts reset
+func (r *Relay) Requeue(ctx context.Context, ids ...int64) error {
+	return r.exec(ctx, "could not requeue outbox events", requeueDead, pq.Array(ids))
+}
+
+func (r *Relay) exec(ctx context.Context, errMessage, query string, args ...interface{}) error {
+	db, err := r.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("%s: %v", errMessage, err)
+	}
+	return nil
+}
+
+// querier runs a query, it's a *sql.DB or *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func claim(ctx context.Context, db querier, batchSize int, lease time.Duration) ([]pendingEvent, error) {
+	rows, err := db.QueryContext(ctx, claimEvents, batchSize, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("could not claim outbox events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []pendingEvent
+	for rows.Next() {
+		var event pendingEvent
+		var headers []byte
+		if err := rows.Scan(&event.id, &event.Topic, &event.Key, &headers, &event.Payload, &event.attempts); err != nil {
+			return nil, fmt.Errorf("could not read outbox event: %v", err)
+		}
+		if err := json.Unmarshal(headers, &event.Headers); err != nil {
+			return nil, fmt.Errorf("could not read headers of outbox event %d: %v", event.id, err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not claim outbox events: %v", err)
+	}
+
+	// RETURNING doesn't keep the order of the subquery
+	sort.Slice(events, func(i, j int) bool { return events[i].id < events[j].id })
+	return events, nil
+}
+
+// relay publishes the event and records the outcome with db. Publish errors are recorded on the event and
+// retried later, only errors recording the outcome are returned. Metrics are reported once the outcome is saved
+func (r *Relay) relay(ctx context.Context, db Execer, event pendingEvent) error {
+	// the relay stopped during the last attempt, so it never got to record the outcome
+	if event.attempts > r.config.MaxAttempts {
+		if _, err := db.ExecContext(ctx, markDead, event.id, errAbandoned); err != nil {
+			return fmt.Errorf("could not dead letter outbox event %d: %v", event.id, err)
+		}
+		r.logger.WithField(logFieldEventID, event.id).WithField(logFieldTopic, event.Topic).Errorf("Dead lettered outbox event after %d attempts", r.config.MaxAttempts)
+		r.reportMetric(metricDeadLettered, event.Topic)
+		return nil
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.config.PublishTimeout)
+	publishErr := r.publisher.Publish(publishCtx, event.Topic, event.Key, event.Headers, event.Payload)
+	cancel()
+
+	if publishErr == nil {
+		if _, err := db.ExecContext(ctx, markDelivered, event.id); err != nil {
+			return fmt.Errorf("could not mark outbox event %d delivered: %v", event.id, err)
+		}
+		r.reportMetric(metricPublished, event.Topic)
+		return nil
+	}
+
+	attempts := event.attempts
+	lastError := truncate(publishErr.Error(), maxErrorLength)
+	logger := r.logger.WithError(publishErr).WithField(logFieldEventID, event.id).WithField(logFieldTopic, event.Topic)
+
+	if attempts >= r.config.MaxAttempts {
+		if _, err := db.ExecContext(ctx, markDead, event.id, lastError); err != nil {
+			return fmt.Errorf("could not dead letter outbox event %d: %v", event.id, err)
+		}
+		logger.Errorf("Dead lettered outbox event after %d attempts", attempts)
+		r.reportMetric(metricDeadLettered, event.Topic)
+		return nil
+	}
+
+	nextAttempt := time.Now().Add(backoff(attempts, r.config.MinBackoff, r.config.MaxBackoff))
+	if _, err := db.ExecContext(ctx, markFailed, event.id, nextAttempt, lastError); err != nil {
+		return fmt.Errorf("could not record outbox event %d failed: %v", event.id, err)
+	}
+	logger.Printf("Could not publish outbox event, attempt %d", attempts)
+	r.reportMetric(metricFailed, event.Topic)
+	return nil
+}
+
+func (r *Relay) reportMetric(name, topic string) {
+	if r.config.MetricsClient != nil {
+		r.config.MetricsClient.InternalCustom(metricOriginatingService, topic, name, map[string]string{"topic": topic}, 1)
+	}
+}
+
+// backoff is how long to wait after the attempt failed, minWait doubled for each attempt after the first up to maxWait
+func backoff(attempts int, minWait, maxWait time.Duration) time.Duration {
+	wait := minWait
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxWait {
+			return maxWait
+		}
+	}
+	return wait
+}
+
+// truncate cuts s to at most n bytes without splitting a character, last_error has to be valid UTF-8
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,215 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-metric-client/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB is a database/sql driver that returns the queued batches for the claim query and records every statement
+type fakeDB struct {
+	mu      sync.Mutex
+	batches [][][]driver.Value
+	claims  int
+	execs   []fakeStatement
+	// failExecID fails the statements for the event with this id
+	failExecID int64
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+func (f *fakeDB) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                            { return nil }
+
+// GetConnection makes fakeDB a connector.SQLDBConnector
+func (f *fakeDB) GetConnection() (*sql.DB, error) { return sql.OpenDB(f), nil }
+
+func (f *fakeDB) claimCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.claims
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if query != claimEvents {
+		return nil, errors.New("unexpected query")
+	}
+
+	c.db.claims++
+	var batch [][]driver.Value
+	if len(c.db.batches) > 0 {
+		batch, c.db.batches = c.db.batches[0], c.db.batches[1:]
+	}
+	return &fakeRows{rows: batch}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.db.execs = append(c.db.execs, fakeStatement{query: query, args: values})
+
+	if id, ok := values[0].(int64); ok && id == c.db.failExecID {
+		return nil, errors.New("connection reset")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"id", "topic", "key", "headers", "payload", "attempts"}
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func outboxRow(id int64, topic string, attempts int64) []driver.Value {
+	return []driver.Value{id, topic, "key", []byte(`{"X-Request-Id": "request-1"}`), []byte(`{}`), attempts}
+}
+
+// fakeMetrics records the custom metrics, the rest of metrics.Client isn't used by the relay
+type fakeMetrics struct {
+	metrics.Client
+	mu      sync.Mutex
+	customs []string
+}
+
+func (f *fakeMetrics) InternalCustom(originatingService, path, customName string, other map[string]string, value int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.customs = append(f.customs, customName)
+	return nil
+}
+
+func TestUnit_Relay_RelayBatch(t *testing.T) {
+	// RETURNING can give the claimed rows in any order
+	db := &fakeDB{
+		batches:    [][][]driver.Value{{outboxRow(3, "brand.updated", 1), outboxRow(1, "brand.updated", 1), outboxRow(2, "broken", 1)}},
+		failExecID: 3,
+	}
+
+	var published []string
+	publisher := publisherFunc(func(topic string) error {
+		published = append(published, topic)
+		if topic == "broken" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	metricsClient := &fakeMetrics{}
+	relay := NewRelay(db, publisher, RelayConfig{BatchSize: 10, Lease: time.Minute, MetricsClient: metricsClient}, logrus.NewEntry(logrus.New()))
+
+	claimed, err := relay.RelayBatch(context.Background())
+	require.Error(t, err, "event 3's outcome couldn't be recorded")
+	require.Equal(t, 3, claimed)
+	require.Equal(t, []string{"brand.updated", "broken", "brand.updated"}, published)
+
+	// each outcome is its own statement, so the failure recording event 3 doesn't undo events 1 and 2
+	require.Len(t, db.execs, 3)
+	require.Equal(t, fakeStatement{query: markDelivered, args: []driver.Value{int64(1)}}, db.execs[0])
+	require.Equal(t, markFailed, db.execs[1].query)
+	require.Equal(t, int64(2), db.execs[1].args[0])
+	require.Equal(t, markDelivered, db.execs[2].query)
+
+	// metrics are only reported for saved outcomes
+	require.Equal(t, []string{metricPublished, metricFailed}, metricsClient.customs)
+}
+
+func TestUnit_Relay_PublishTimeout(t *testing.T) {
+	db := &fakeDB{batches: [][][]driver.Value{{outboxRow(1, "slow", 1)}}}
+	publisher := producerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	relay := NewRelay(db, publisher, RelayConfig{PublishTimeout: 10 * time.Millisecond}, logrus.NewEntry(logrus.New()))
+
+	_, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	require.Len(t, db.execs, 1)
+	require.Equal(t, markFailed, db.execs[0].query)
+}
+
+func TestUnit_NewRelay_Lease(t *testing.T) {
+	// a batch that times out on every publish still finishes within the lease
+	relay := NewRelay(nil, nil, RelayConfig{BatchSize: 10, PublishTimeout: time.Second}, nil)
+	require.Equal(t, 10*time.Second+defaultLeaseMargin, relay.config.Lease)
+
+	relay = NewRelay(nil, nil, RelayConfig{Lease: time.Minute}, nil)
+	require.Equal(t, time.Minute, relay.config.Lease)
+}
+
+func TestUnit_Relay_Run(t *testing.T) {
+	// a full batch is followed by the next claim right away, an empty one waits the poll interval
+	db := &fakeDB{batches: [][][]driver.Value{{outboxRow(1, "brand.updated", 1)}, {outboxRow(2, "brand.updated", 1)}}}
+	relay := NewRelay(db, publisherFunc(func(string) error { return nil }), RelayConfig{BatchSize: 1, PollInterval: time.Hour}, logrus.NewEntry(logrus.New()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return db.claimCount() == 3 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	require.Equal(t, 3, db.claimCount())
+	require.Len(t, db.execs, 2)
+}
+
+func TestUnit_Relay_DeadEvents(t *testing.T) {
+	db := &fakeDB{}
+	relay := NewRelay(db, publisherFunc(func(string) error { return nil }), RelayConfig{}, logrus.NewEntry(logrus.New()))
+
+	olderThan := time.Now()
+	require.NoError(t, relay.DeleteDelivered(context.Background(), olderThan))
+	require.NoError(t, relay.PurgeDead(context.Background(), olderThan))
+	require.NoError(t, relay.Requeue(context.Background(), 4, 5))
+
+	require.Equal(t, []string{deleteDelivered, purgeDead, requeueDead}, []string{db.execs[0].query, db.execs[1].query, db.execs[2].query})
+	require.Equal(t, "{4,5}", db.execs[2].args[0])
+}
+
+type producerFunc func(ctx context.Context) error
+
+func (f producerFunc) Publish(ctx context.Context, topic, key string, headers map[string]string, payload []byte) error {
+	return f(ctx)
+}
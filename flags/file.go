@@ -0,0 +1,94 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// file is the layout of a flag file, json files work too since yaml is a superset of json
+type file struct {
+	Flags []Flag `yaml:"flags"`
+}
+
+type fileProvider struct {
+	*cache
+	path    string
+	modTime time.Time
+	logger  *logrus.Entry
+}
+
+// NewFileProvider creates a Provider from a yaml (or json) file of flags:
+//
+//	flags:
+//	  - name: new-checkout
+//	    enabled: true
+//	    rules:
+//	      brand_ids: [42]
+//	      percentage: 10
+//
+// The file is checked for changes every reloadInterval until ctx is done. A file that can't be read or
+// parsed when reloading is logged and the flags already loaded are kept. A default logger is used when logger is nil
+func NewFileProvider(ctx context.Context, path string, reloadInterval time.Duration, logger *logrus.Entry) (Provider, error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.New())
+	}
+	p := &fileProvider{cache: &cache{}, path: path, logger: logger}
+	if _, err := p.reload(); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 {
+		go p.watch(ctx, reloadInterval)
+	}
+
+	return p, nil
+}
+
+func (p *fileProvider) watch(ctx context.Context, reloadInterval time.Duration) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := p.reload()
+			if err != nil {
+				p.logger.WithError(err).Errorf("Could not reload flags from %s", p.path)
+			} else if reloaded {
+				p.logger.Printf("Reloaded flags from %s", p.path)
+			}
+		}
+	}
+}
+
+// reload loads the file if it changed since it was last loaded
+func (p *fileProvider) reload() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, fmt.Errorf("could not stat flag file: %v", err)
+	}
+	if info.ModTime().Equal(p.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return false, fmt.Errorf("could not read flag file: %v", err)
+	}
+
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return false, fmt.Errorf("could not parse flag file: %v", err)
+	}
+
+	p.set(f.Flags)
+	p.modTime = info.ModTime()
+	return true, nil
+}
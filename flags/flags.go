@@ -0,0 +1,222 @@
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/alice/middleware/lrw"
+)
+
+// logFieldPrefix is added to the flag name for the log field that records its evaluation
+const logFieldPrefix = "flag."
+
+// rolloutBuckets is the resolution of a percentage rollout
+const rolloutBuckets = 10000
+
+// Flag is a feature flag and the rules that turn it on
+type Flag struct {
+	Name    string `json:"name" yaml:"name"`
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Rules   Rules  `json:"rules" yaml:"rules"`
+}
+
+// Rules target an enabled flag at some requests. A flag with no rules is on for everyone, otherwise it is on
+// when any of the targeting rules match or the request falls within the percentage rollout
+type Rules struct {
+	// UserIDs are matched against the user ID and UUID from the validated claims
+	UserIDs []string `json:"user_ids,omitempty" yaml:"user_ids,omitempty"`
+	// Roles are matched against the roles in the claims
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// BrandIDs are matched against the brands in the claims
+	BrandIDs []int64 `json:"brand_ids,omitempty" yaml:"brand_ids,omitempty"`
+	// RetailerIDs are matched against the retailers in the claims
+	RetailerIDs []int64 `json:"retailer_ids,omitempty" yaml:"retailer_ids,omitempty"`
+	// CanaryVersions are matched against the canary version of the request
+	CanaryVersions []string `json:"canary_versions,omitempty" yaml:"canary_versions,omitempty"`
+	// Percentage (0-100) of users that get the flag, requests without a user are split by request ID
+	Percentage float64 `json:"percentage,omitempty" yaml:"percentage,omitempty"`
+}
+
+// Provider looks up flags by name
+type Provider interface {
+	Flag(name string) (Flag, bool)
+}
+
+var requestFlagsKey = contextkey.Of[*requestFlags](contextkey.ContextKeyFlags)
+
+// requestFlags is put in the context by Inject so evaluations can find the provider and be logged
+type requestFlags struct {
+	provider Provider
+
+	mu  sync.Mutex
+	lrw *lrw.LoggingResponseWriter
+}
+
+// Inject puts the provider in the context so flags can be evaluated with Enabled. Each evaluation is added
+// to the request log as a flag.<name> field
+func Inject(provider Provider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			loggingResponseWriter := lrw.Wrap(w)
+
+			ctx := requestFlagsKey.WithValue(r.Context(), &requestFlags{provider: provider, lrw: loggingResponseWriter})
+			next.ServeHTTP(loggingResponseWriter, r.WithContext(ctx))
+		})
+	}
+}
+
+// Enabled returns true if the flag is on for the request in ctx. Unknown flags and requests that
+// didn't go through Inject are off
+func Enabled(ctx context.Context, name string) bool {
+	rf, ok := requestFlagsKey.Get(ctx)
+	if !ok {
+		return false
+	}
+
+	flag, ok := rf.provider.Flag(name)
+	enabled := ok && flag.Evaluate(ctx)
+
+	rf.mu.Lock()
+	rf.lrw.ForceAddLogField(logFieldPrefix+name, strconv.FormatBool(enabled))
+	rf.mu.Unlock()
+
+	return enabled
+}
+
+// Evaluate returns true if the flag is on for the request in ctx, using the claims, user ID,
+// canary version and request ID the middleware put in the context
+func (f Flag) Evaluate(ctx context.Context) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	rules := f.Rules
+	if !rules.targeted() && rules.Percentage == 0 {
+		return true
+	}
+
+	userIDs := userIDs(ctx)
+	for _, userID := range userIDs {
+		if containsString(rules.UserIDs, userID) {
+			return true
+		}
+	}
+
+	if claims, err := middleware.GetClaimsFromCtx(ctx); err == nil {
+		for _, role := range rules.Roles {
+			if claims.IsRole(role) {
+				return true
+			}
+		}
+		for _, brandID := range claims.GetBrands() {
+			if containsInt64(rules.BrandIDs, brandID) {
+				return true
+			}
+		}
+		for _, retailerID := range claims.GetRetailers() {
+			if containsInt64(rules.RetailerIDs, retailerID) {
+				return true
+			}
+		}
+	}
+
+	if canary, err := middleware.GetCanaryVersionFromCtx(ctx); err == nil && containsString(rules.CanaryVersions, canary) {
+		return true
+	}
+
+	if rules.Percentage > 0 {
+		key, _ := middleware.GetRequestIDFromCtx(ctx)
+		if len(userIDs) > 0 {
+			key = userIDs[0]
+		}
+		// the flag name is part of the key so each flag rolls out to a different set of users
+		return inRollout(f.Name+":"+key, rules.Percentage)
+	}
+
+	return false
+}
+
+// targeted returns true if any of the targeting rules are set
+func (r Rules) targeted() bool {
+	return len(r.UserIDs) > 0 || len(r.Roles) > 0 || len(r.BrandIDs) > 0 || len(r.RetailerIDs) > 0 || len(r.CanaryVersions) > 0
+}
+
+// userIDs returns the IDs the request's user can be matched by, the first one is used for the rollout.
+// Only validated claims are used, the unverified user ID from the UserIDInjector could be forged
+func userIDs(ctx context.Context) []string {
+	var userIDs []string
+	if claims, err := middleware.GetClaimsFromCtx(ctx); err == nil {
+		if claims.GetUserUUID() != "" {
+			userIDs = append(userIDs, claims.GetUserUUID())
+		}
+		if claims.GetUserID() != 0 {
+			userIDs = append(userIDs, strconv.FormatInt(claims.GetUserID(), 10))
+		}
+	}
+	return userIDs
+}
+
+func inRollout(key string, percentage float64) bool {
+	if percentage >= 100 {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()%rolloutBuckets < uint64(percentage/100*rolloutBuckets)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt64(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// cache holds the flags loaded by a provider
+type cache struct {
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewStaticProvider creates a Provider with a fixed set of flags, useful for tests
+func NewStaticProvider(flags ...Flag) Provider {
+	c := &cache{}
+	c.set(flags)
+	return c
+}
+
+// Flag returns the flag with the name, ok is false when there is no such flag
+func (c *cache) Flag(name string) (Flag, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	flag, ok := c.flags[name]
+	return flag, ok
+}
+
+func (c *cache) set(flags []Flag) {
+	byName := make(map[string]Flag, len(flags))
+	for _, flag := range flags {
+		byName[flag.Name] = flag
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flags = byName
+}
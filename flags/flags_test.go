@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/alice/middleware/lrw"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_Evaluate(t *testing.T) {
+	claims := auth.NewClaim([]int64{42}, nil, nil, time.Now().Add(time.Hour), nil, []int64{7}, []string{"brand"}, 1, "user-uuid", 0, "", nil)
+
+	testCases := []struct {
+		name     string
+		flag     Flag
+		ctx      context.Context
+		expected bool
+	}{
+		{name: "disabled", flag: Flag{Name: "f"}, ctx: context.Background(), expected: false},
+		{name: "enabled without rules", flag: Flag{Name: "f", Enabled: true}, ctx: context.Background(), expected: true},
+		{name: "user uuid", flag: Flag{Name: "f", Enabled: true, Rules: Rules{UserIDs: []string{"user-uuid"}}}, ctx: withClaims(claims), expected: true},
+		{name: "user id", flag: Flag{Name: "f", Enabled: true, Rules: Rules{UserIDs: []string{"1"}}}, ctx: withClaims(claims), expected: true},
+		{name: "forged user id", flag: Flag{Name: "f", Enabled: true, Rules: Rules{UserIDs: []string{"99"}}}, ctx: context.WithValue(context.Background(), contextkey.ContextKeyInsecureUserID, "99"), expected: false},
+		{name: "role", flag: Flag{Name: "f", Enabled: true, Rules: Rules{Roles: []string{"brand"}}}, ctx: withClaims(claims), expected: true},
+		{name: "brand", flag: Flag{Name: "f", Enabled: true, Rules: Rules{BrandIDs: []int64{42}}}, ctx: withClaims(claims), expected: true},
+		{name: "retailer", flag: Flag{Name: "f", Enabled: true, Rules: Rules{RetailerIDs: []int64{7}}}, ctx: withClaims(claims), expected: true},
+		{name: "canary", flag: Flag{Name: "f", Enabled: true, Rules: Rules{CanaryVersions: []string{"v2"}}}, ctx: context.WithValue(context.Background(), contextkey.ContextKeyCanary, "v2"), expected: true},
+		{name: "no rule matches", flag: Flag{Name: "f", Enabled: true, Rules: Rules{BrandIDs: []int64{1}, Roles: []string{"admin"}}}, ctx: withClaims(claims), expected: false},
+		{name: "full rollout", flag: Flag{Name: "f", Enabled: true, Rules: Rules{Percentage: 100}}, ctx: withClaims(claims), expected: true},
+		{name: "disabled ignores rules", flag: Flag{Name: "f", Rules: Rules{BrandIDs: []int64{42}}}, ctx: withClaims(claims), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.flag.Evaluate(tc.ctx))
+		})
+	}
+}
+
+func TestUnit_EvaluateRollout(t *testing.T) {
+	flag := Flag{Name: "f", Enabled: true, Rules: Rules{Percentage: 25}}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		ctx := context.WithValue(context.Background(), contextkey.ContextKeyRequestID, time.Duration(i).String())
+		first := flag.Evaluate(ctx)
+		require.Equal(t, first, flag.Evaluate(ctx), "rollout should be sticky")
+		if first {
+			enabled++
+		}
+	}
+
+	require.InDelta(t, 250, enabled, 60)
+}
+
+func TestUnit_Enabled(t *testing.T) {
+	provider := NewStaticProvider(Flag{Name: "on", Enabled: true}, Flag{Name: "off"})
+
+	var on, off, unknown bool
+	handler := Inject(provider)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		on = Enabled(r.Context(), "on")
+		off = Enabled(r.Context(), "off")
+		unknown = Enabled(r.Context(), "unknown")
+	}))
+
+	w := lrw.NewLoggingResponseWriter(httptest.NewRecorder())
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.True(t, on)
+	require.False(t, off)
+	require.False(t, unknown)
+	require.Equal(t, map[string]string{"flag.on": "true", "flag.off": "false", "flag.unknown": "false"}, w.ExtraFields)
+	require.False(t, Enabled(context.Background(), "on"))
+}
+
+func TestUnit_FileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("flags:\n  - name: a\n    enabled: true\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	provider, err := NewFileProvider(ctx, path, 10*time.Millisecond, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+
+	flag, ok := provider.Flag("a")
+	require.True(t, ok)
+	require.True(t, flag.Enabled)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"flags": [{"name": "b", "enabled": true, "rules": {"brand_ids": [42]}}]}`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+
+	require.Eventually(t, func() bool {
+		_, ok := provider.Flag("b")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	flag, _ = provider.Flag("b")
+	require.Equal(t, []int64{42}, flag.Rules.BrandIDs)
+	_, ok = provider.Flag("a")
+	require.False(t, ok)
+
+	_, err = NewFileProvider(ctx, filepath.Join(t.TempDir(), "missing.yaml"), 0, logrus.NewEntry(logrus.New()))
+	require.Error(t, err)
+}
+
+func withClaims(claims auth.Claim) context.Context {
+	return context.WithValue(context.Background(), contextkey.ContextKeyClaims, claims)
+}
@@ -0,0 +1,94 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/promoboxx/go-service/database/connector"
+	"github.com/sirupsen/logrus"
+)
+
+// Schema creates the table the postgres provider reads flags from
+const Schema = `CREATE TABLE IF NOT EXISTS feature_flag (
+	name    text PRIMARY KEY,
+	enabled boolean NOT NULL DEFAULT false,
+	rules   jsonb NOT NULL DEFAULT '{}'
+)`
+
+const selectFlags = `SELECT name, enabled, rules FROM feature_flag`
+
+type postgresProvider struct {
+	*cache
+	connector connector.SQLDBConnector
+	logger    *logrus.Entry
+}
+
+// NewPostgresProvider creates a Provider from the feature_flag table (see Schema), the rules column holds
+// the Rules as json. Flags are read into memory so evaluating them doesn't query the database, and are
+// refreshed every refreshInterval until ctx is done. Refresh errors are logged and the flags already loaded are kept.
+// A default logger is used when logger is nil
+func NewPostgresProvider(ctx context.Context, dbConnector connector.SQLDBConnector, refreshInterval time.Duration, logger *logrus.Entry) (Provider, error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.New())
+	}
+	p := &postgresProvider{cache: &cache{}, connector: dbConnector, logger: logger}
+	if err := p.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	if refreshInterval > 0 {
+		go p.watch(ctx, refreshInterval)
+	}
+
+	return p, nil
+}
+
+func (p *postgresProvider) watch(ctx context.Context, refreshInterval time.Duration) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.refresh(ctx); err != nil {
+				p.logger.WithError(err).Error("Could not refresh flags from the database")
+			}
+		}
+	}
+}
+
+func (p *postgresProvider) refresh(ctx context.Context) error {
+	db, err := p.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, selectFlags)
+	if err != nil {
+		return fmt.Errorf("could not query flags: %v", err)
+	}
+	defer rows.Close()
+
+	var flags []Flag
+	for rows.Next() {
+		var flag Flag
+		var rules []byte
+		if err := rows.Scan(&flag.Name, &flag.Enabled, &rules); err != nil {
+			return fmt.Errorf("could not scan flag: %v", err)
+		}
+		if err := json.Unmarshal(rules, &flag.Rules); err != nil {
+			return fmt.Errorf("could not parse rules for flag %s: %v", flag.Name, err)
+		}
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not read flags: %v", err)
+	}
+
+	p.set(flags)
+	return nil
+}
@@ -0,0 +1,64 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type writerProducer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// writtenMessage is a Message as it's written by the writer producer, json payloads are written as is so they
+// are readable and anything else is written as a string
+type writtenMessage struct {
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload interface{}       `json:"payload"`
+}
+
+// NewWriterProducer writes each message to w as a line of json, it's meant for local development.
+// Use NewWriterProducer(os.Stdout) to print the messages
+func NewWriterProducer(w io.Writer) Producer {
+	return &writerProducer{w: w}
+}
+
+// FileProducer appends each message to a file as a line of json, it's meant for local development
+type FileProducer struct {
+	writerProducer
+	file *os.File
+}
+
+// NewFileProducer creates a FileProducer that appends to the file at path, Close closes the file
+func NewFileProducer(path string) (*FileProducer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open producer file: %v", err)
+	}
+	return &FileProducer{writerProducer: writerProducer{w: file}, file: file}, nil
+}
+
+// Close closes the file
+func (p *FileProducer) Close() error {
+	return p.file.Close()
+}
+
+func (p *writerProducer) Publish(ctx context.Context, topic, key string, headers map[string]string, payload []byte) error {
+	message := writtenMessage{Topic: topic, Key: key, Headers: headers, Payload: string(payload)}
+	if json.Valid(payload) {
+		message.Payload = json.RawMessage(payload)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := json.NewEncoder(p.w).Encode(message); err != nil {
+		return fmt.Errorf("could not write message: %v", err)
+	}
+	return nil
+}
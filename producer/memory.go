@@ -0,0 +1,38 @@
+package producer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryProducer keeps the messages published to it, it's meant for tests
+type MemoryProducer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryProducer creates an empty MemoryProducer
+func NewMemoryProducer() *MemoryProducer {
+	return &MemoryProducer{}
+}
+
+func (p *MemoryProducer) Publish(ctx context.Context, topic, key string, headers map[string]string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, Message{Topic: topic, Key: key, Headers: headers, Payload: payload})
+	return nil
+}
+
+// Messages returns the messages published so far, optionally only the ones published to topic
+func (p *MemoryProducer) Messages(topic ...string) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	messages := make([]Message, 0, len(p.messages))
+	for _, message := range p.messages {
+		if len(topic) == 0 || message.Topic == topic[0] {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
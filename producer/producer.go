@@ -0,0 +1,123 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/alice/middleware/trace"
+)
+
+// Producer publishes messages to a topic
+type Producer interface {
+	Publish(ctx context.Context, topic, key string, headers map[string]string, payload []byte) error
+}
+
+// Message is a published message
+type Message struct {
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload []byte            `json:"payload"`
+}
+
+var producerKey = contextkey.Of[Producer](contextkey.ContextKeyProducer)
+
+// InjectProducer puts the producer in the context, wrapped with WithPropagation so the messages published
+// while handling the request carry its request ID, trace context and canary version
+func InjectProducer(producer Producer) func(http.Handler) http.Handler {
+	propagating := WithPropagation(producer)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := producerKey.WithValue(r.Context(), propagating)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetProducerFromCtx returns the producer and an error if it's not present
+func GetProducerFromCtx(ctx context.Context) (Producer, error) {
+	producer, ok := producerKey.Get(ctx)
+	if !ok {
+		return nil, errors.New("no producer in context")
+	}
+	return producer, nil
+}
+
+// MustGetProducerFromContext returns the producer and panics if it's not present
+func MustGetProducerFromContext(ctx context.Context) Producer {
+	producer, err := GetProducerFromCtx(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return producer
+}
+
+type propagatingProducer struct {
+	base Producer
+}
+
+// WithPropagation returns a Producer that adds the request ID, trace context and canary version of the
+// publishing context to the message headers. Headers already given to Publish are left alone
+func WithPropagation(base Producer) Producer {
+	if _, ok := base.(*propagatingProducer); ok {
+		return base
+	}
+	return &propagatingProducer{base: base}
+}
+
+func (p *propagatingProducer) Publish(ctx context.Context, topic, key string, headers map[string]string, payload []byte) error {
+	return p.base.Publish(ctx, topic, key, PropagatedHeaders(ctx, headers), payload)
+}
+
+// PropagatedHeaders returns a copy of headers with the request ID, trace context and canary version of ctx added.
+// It's for messages that are published later, away from the request, like through an outbox. Headers are kept
+// with the names they were given in and replace the propagated ones whatever their case. The W3C trace context
+// headers are lowercase since message headers are case sensitive
+func PropagatedHeaders(ctx context.Context, headers map[string]string) map[string]string {
+	h := http.Header{}
+	if requestID, err := middleware.GetRequestIDFromCtx(ctx); err == nil && requestID != "" {
+		h.Set(middleware.HeaderRequestID, requestID)
+	}
+	if canary, err := middleware.GetCanaryVersionFromCtx(ctx); err == nil && canary != "" {
+		h.Set(middleware.HeaderCanaryVersion, canary)
+	}
+	trace.Inject(ctx, h)
+
+	propagated := make(map[string]string, len(h))
+	for name := range h {
+		propagated[name] = h.Get(name)
+	}
+	for _, name := range []string{middleware.HeaderTraceParent, middleware.HeaderTraceState} {
+		canonical := http.CanonicalHeaderKey(name)
+		if value, ok := propagated[canonical]; ok {
+			delete(propagated, canonical)
+			propagated[name] = value
+		}
+	}
+
+	out := make(map[string]string, len(headers)+len(propagated))
+	for name, value := range propagated {
+		if !hasHeader(headers, name) {
+			out[name] = value
+		}
+	}
+	for name, value := range headers {
+		out[name] = value
+	}
+	return out
+}
+
+// hasHeader returns true if headers has name in any case
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
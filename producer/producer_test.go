@@ -0,0 +1,95 @@
+package producer
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/promoboxx/go-service/alice/middleware/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_InjectProducer(t *testing.T) {
+	memory := NewMemoryProducer()
+
+	handler := InjectProducer(memory)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		producer := MustGetProducerFromContext(r.Context())
+		require.NoError(t, producer.Publish(r.Context(), "brand.updated", "42", nil, []byte(`{"id": 42}`)))
+		require.NoError(t, producer.Publish(r.Context(), "brand.deleted", "42", map[string]string{"x-request-id": "mine"}, nil))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/brand/42", nil)
+	ctx := context.WithValue(r.Context(), contextkey.ContextKeyRequestID, "request-1")
+	ctx = context.WithValue(ctx, contextkey.ContextKeyCanary, "v2")
+	handler.ServeHTTP(httptest.NewRecorder(), r.WithContext(ctx))
+
+	updated := memory.Messages("brand.updated")
+	require.Len(t, updated, 1)
+	require.Equal(t, "42", updated[0].Key)
+	require.Equal(t, "request-1", updated[0].Headers["X-Request-Id"])
+	require.Equal(t, "v2", updated[0].Headers["X-Canary-Version"])
+
+	// headers given to Publish win, whatever their case
+	deleted := memory.Messages("brand.deleted")
+	require.Len(t, deleted, 1)
+	require.Equal(t, map[string]string{"x-request-id": "mine", "X-Canary-Version": "v2"}, deleted[0].Headers)
+
+	require.Len(t, memory.Messages(), 2)
+
+	_, err := GetProducerFromCtx(context.Background())
+	require.Error(t, err)
+}
+
+func TestUnit_InjectProducer_TraceContext(t *testing.T) {
+	memory := NewMemoryProducer()
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	handler := trace.NewOpenTracingTimer().Time("publish")(InjectProducer(memory)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, MustGetProducerFromContext(r.Context()).Publish(r.Context(), "brand.updated", "42", nil, nil))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/brand/42", nil)
+	r.Header.Set(middleware.HeaderTraceParent, traceParent)
+	r.Header.Set(middleware.HeaderTraceState, "vendor=value")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	messages := memory.Messages("brand.updated")
+	require.Len(t, messages, 1)
+	require.Equal(t, traceParent, messages[0].Headers["traceparent"])
+	require.Equal(t, "vendor=value", messages[0].Headers["tracestate"])
+	require.NotContains(t, messages[0].Headers, "Traceparent")
+}
+
+func TestUnit_FileProducer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.jsonl")
+	producer, err := NewFileProducer(path)
+	require.NoError(t, err)
+
+	require.NoError(t, producer.Publish(context.Background(), "brand.updated", "42", nil, []byte(`{"id":42}`)))
+	require.NoError(t, producer.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `{"topic":"brand.updated","key":"42","payload":{"id":42}}`+"\n", string(data))
+}
+
+func TestUnit_WriterProducer(t *testing.T) {
+	var buf bytes.Buffer
+	producer := NewWriterProducer(&buf)
+
+	require.NoError(t, producer.Publish(context.Background(), "brand.updated", "42", map[string]string{"a": "b"}, []byte(`{"id":42}`)))
+	require.NoError(t, producer.Publish(context.Background(), "brand.deleted", "", nil, []byte("not json")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, []string{
+		`{"topic":"brand.updated","key":"42","headers":{"a":"b"},"payload":{"id":42}}`,
+		`{"topic":"brand.deleted","payload":"not json"}`,
+	}, lines)
+}
@@ -0,0 +1,340 @@
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+)
+
+// metric types in the text exposition format
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// labelSeparator joins label values into a key, it can't appear in valid UTF-8 text
+const labelSeparator = "\xff"
+
+// DefaultBuckets are the default histogram buckets, in seconds, suited to request durations
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them in the Prometheus text exposition format
+type Registry struct {
+	mu         sync.RWMutex
+	families   []*family
+	byName     map[string]*family
+	collectors []func()
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]*family{}}
+}
+
+// NewCounter registers a counter, if one with the name already exists it is returned
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{family: r.register(name, help, typeCounter, nil, labelNames)}
+}
+
+// NewGauge registers a gauge, if one with the name already exists it is returned
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{family: r.register(name, help, typeGauge, nil, labelNames)}
+}
+
+// NewHistogram registers a histogram with the upper bounds in buckets, DefaultBuckets are used when buckets is empty.
+// If one with the name already exists it is returned
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsInf(b, 1) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+
+	return &Histogram{family: r.register(name, help, typeHistogram, sorted, labelNames)}
+}
+
+// AddCollector adds a function that is called before every scrape, so values that are read
+// from somewhere else (like sql.DBStats) can be set on gauges
+func (r *Registry) AddCollector(collect func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collect)
+}
+
+// ServeHTTP writes the metrics, it is meant to be served on the admin listener
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := r.WriteTo(w); err != nil {
+		middleware.MustGetLoggerFromContext(req.Context()).WithError(err).Errorf("Could not write metrics")
+	}
+}
+
+// WriteTo runs the collectors and writes every metric in the text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	collectors := r.collectors
+	families := r.families
+	r.mu.RUnlock()
+
+	for _, collect := range collectors {
+		collect()
+	}
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+func (r *Registry) register(name, help, metricType string, buckets []float64, labelNames []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.byName[name]; ok {
+		if f.metricType != metricType || len(f.labelNames) != len(labelNames) {
+			panic(fmt.Sprintf("metric %s is already registered as a %s with %d labels", name, f.metricType, len(f.labelNames)))
+		}
+		return f
+	}
+
+	f := &family{name: name, help: help, metricType: metricType, buckets: buckets, labelNames: labelNames, children: map[string]*child{}}
+	r.families = append(r.families, f)
+	r.byName[name] = f
+	return f
+}
+
+type family struct {
+	name       string
+	help       string
+	metricType string
+	buckets    []float64
+	labelNames []string
+
+	mu       sync.Mutex
+	children map[string]*child
+}
+
+type child struct {
+	labelValues []string
+	value       float64
+	// histograms only
+	counts []uint64
+	count  uint64
+}
+
+// get returns the child for the label values, creating it if needed. f.mu must be held
+func (f *family) get(labelValues []string) *child {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, labelSeparator)
+	c, ok := f.children[key]
+	if !ok {
+		c = &child{labelValues: append([]string(nil), labelValues...)}
+		if f.metricType == typeHistogram {
+			c.counts = make([]uint64, len(f.buckets))
+		}
+		f.children[key] = c
+	}
+	return c
+}
+
+// delete removes the child for the label values
+func (f *family) delete(labelValues []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.children, strings.Join(labelValues, labelSeparator))
+}
+
+func (f *family) write(w *countingWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.children) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.metricType)
+
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		c := f.children[k]
+		if f.metricType != typeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, labels(f.labelNames, c.labelValues, "", ""), formatFloat(c.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, upper := range f.buckets {
+			cumulative += c.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels(f.labelNames, c.labelValues, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labels(f.labelNames, c.labelValues, "le", "+Inf"), c.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labels(f.labelNames, c.labelValues, "", ""), formatFloat(c.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, labels(f.labelNames, c.labelValues, "", ""), c.count)
+	}
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	family *family
+}
+
+// Inc adds 1 to the counter with the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the counter with the label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	c.family.get(labelValues).value += v
+}
+
+// Set sets the counter with the label values to v, it is meant for collectors that copy a total kept
+// somewhere else, like sql.DBStats.WaitCount
+func (c *Counter) Set(v float64, labelValues ...string) {
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	c.family.get(labelValues).value = v
+}
+
+// Delete removes the counter with the label values, for things that no longer exist
+func (c *Counter) Delete(labelValues ...string) {
+	c.family.delete(labelValues)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	family *family
+}
+
+// Set sets the gauge with the label values to v
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.family.mu.Lock()
+	defer g.family.mu.Unlock()
+	g.family.get(labelValues).value = v
+}
+
+// Add adds v to the gauge with the label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.family.mu.Lock()
+	defer g.family.mu.Unlock()
+	g.family.get(labelValues).value += v
+}
+
+// Delete removes the gauge with the label values, for things that no longer exist
+func (g *Gauge) Delete(labelValues ...string) {
+	g.family.delete(labelValues)
+}
+
+// Histogram counts observations into buckets
+type Histogram struct {
+	family *family
+}
+
+// Observe adds v to the histogram with the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.family.mu.Lock()
+	defer h.family.mu.Unlock()
+
+	c := h.family.get(labelValues)
+	c.value += v
+	c.count++
+	for i, upper := range h.family.buckets {
+		if v <= upper {
+			c.counts[i]++
+			break
+		}
+	}
+}
+
+// labels formats the label set, adding the extra label if extraName is set
+func labels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeLabelValue(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter keeps the number of bytes written and the first error so the writes above don't each need checking
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
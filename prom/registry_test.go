@@ -0,0 +1,66 @@
+package prom
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_Registry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounter("requests_total", "Requests.\nAll of them.", "route")
+	gauge := r.NewGauge("temperature", "Current temperature.")
+	histogram := r.NewHistogram("duration_seconds", "Durations.", []float64{1, 0.1}, "route")
+	r.NewCounter("unused_total", "Never written.")
+
+	counter.Inc(`get "user"`)
+	counter.Add(2, `get "user"`)
+	gauge.Set(-1.5)
+	histogram.Observe(0.05, "a")
+	histogram.Observe(0.5, "a")
+	histogram.Observe(5, "a")
+
+	collected := 0
+	r.AddCollector(func() { collected++ })
+
+	buf := &bytes.Buffer{}
+	_, err := r.WriteTo(buf)
+	require.NoError(t, err)
+	require.Equal(t, 1, collected)
+
+	require.Equal(t, `# HELP requests_total Requests.\nAll of them.
+# TYPE requests_total counter
+requests_total{route="get \"user\""} 3
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature -1.5
+# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="a",le="0.1"} 1
+duration_seconds_bucket{route="a",le="1"} 2
+duration_seconds_bucket{route="a",le="+Inf"} 3
+duration_seconds_sum{route="a"} 5.55
+duration_seconds_count{route="a"} 3
+`, buf.String())
+}
+
+func TestUnit_Registry_Delete(t *testing.T) {
+	r := NewRegistry()
+	gauge := r.NewGauge("open_connections", "Open connections.", "db")
+	counter := r.NewCounter("waits_total", "Waits.", "db")
+
+	gauge.Set(2, "brands")
+	gauge.Set(3, "posts")
+	counter.Inc("brands")
+	gauge.Delete("brands")
+	counter.Delete("brands")
+
+	buf := &bytes.Buffer{}
+	_, err := r.WriteTo(buf)
+	require.NoError(t, err)
+	require.Equal(t, `# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections{db="posts"} 3
+`, buf.String())
+}
@@ -0,0 +1,49 @@
+package prom
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/justinas/alice"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/lrw"
+)
+
+type timer struct {
+	requests *Counter
+	errors   *Counter
+	duration *Histogram
+}
+
+// NewTimer creates a Timer that records the requests, 5xx errors and duration of each measured route in
+// the registry. buckets are the duration histogram buckets in seconds, DefaultBuckets are used when it is empty
+//
+// Expected usage:
+// registry := prom.NewRegistry()
+// b := chain.NewBase(alice.New(), middleware.NewCompositeTimer(trace.NewOpenTracingTimer(), prom.NewTimer(registry, nil)), logger, jwtdecode.NewJWTDecoder())
+// adminRouter.Get("/metrics", registry.ServeHTTP)
+func NewTimer(registry *Registry, buckets []float64) middleware.Timer {
+	return &timer{
+		requests: registry.NewCounter("http_requests_total", "Requests handled by route, method and status class.", "route", "method", "status_class"),
+		errors:   registry.NewCounter("http_request_errors_total", "Requests that ended with a 5xx status by route.", "route"),
+		duration: registry.NewHistogram("http_request_duration_seconds", "Time spent handling requests by route.", buckets, "route"),
+	}
+}
+
+func (t *timer) Time(name string) alice.Constructor {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// make the response writer a logging response writer so we can access the status code
+			loggingResponseWriter := lrw.Wrap(w)
+
+			start := time.Now()
+			h.ServeHTTP(loggingResponseWriter, r)
+
+			t.duration.Observe(time.Since(start).Seconds(), name)
+			t.requests.Inc(name, r.Method, middleware.StatusClass(loggingResponseWriter.StatusCode))
+			if loggingResponseWriter.StatusCode >= http.StatusInternalServerError {
+				t.errors.Inc(name)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// file is the layout of a revocation file
+type file struct {
+	// Tokens are the revoked token IDs
+	Tokens []string `yaml:"tokens"`
+	// Users maps user UUIDs to the time before which their tokens are revoked
+	Users map[string]time.Time `yaml:"users"`
+}
+
+var _ middleware.RevocationChecker = &FileStore{}
+
+// FileStore reads revocations from a yaml file, it's read only so revocations are made by editing the file
+type FileStore struct {
+	path   string
+	logger *logrus.Entry
+
+	mu      sync.RWMutex
+	modTime time.Time
+	tokens  map[string]bool
+	users   map[string]time.Time
+}
+
+// NewFileStore creates a FileStore from a yaml file:
+//
+//	tokens:
+//	  - 3f9a...
+//	users:
+//	  5d6e0f4c-...: 2024-03-01T12:00:00Z
+//
+// The file is checked for changes every reloadInterval until ctx is done. A file that can't be read or parsed
+// when reloading is logged and the revocations already loaded are kept. A default logger is used when logger is nil
+func NewFileStore(ctx context.Context, path string, reloadInterval time.Duration, logger *logrus.Entry) (*FileStore, error) {
+	if logger == nil {
+		logger = logrus.NewEntry(logrus.New())
+	}
+	s := &FileStore{path: path, logger: logger}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 {
+		go s.watch(ctx, reloadInterval)
+	}
+
+	return s, nil
+}
+
+// IsRevoked returns true if the token ID or every token for the user issued before issuedAt was revoked
+func (s *FileStore) IsRevoked(ctx context.Context, tokenID, userUUID string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.tokens[tokenID] {
+		return true, nil
+	}
+	if issuedBefore, ok := s.users[userUUID]; ok && issuedBeforeRevoked(issuedAt, issuedBefore) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (s *FileStore) watch(ctx context.Context, reloadInterval time.Duration) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				s.logger.WithError(err).Errorf("Could not reload revocations from %s", s.path)
+			} else if reloaded {
+				s.logger.Printf("Reloaded revocations from %s", s.path)
+			}
+		}
+	}
+}
+
+// reload loads the file if it changed since it was last loaded
+func (s *FileStore) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, fmt.Errorf("could not stat revocation file: %v", err)
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("could not read revocation file: %v", err)
+	}
+
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return false, fmt.Errorf("could not parse revocation file: %v", err)
+	}
+
+	tokens := make(map[string]bool, len(f.Tokens))
+	for _, tokenID := range f.Tokens {
+		tokens[tokenID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = tokens
+	s.users = f.Users
+	s.modTime = info.ModTime()
+
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+)
+
+var _ middleware.RevocationChecker = &MemoryStore{}
+var _ middleware.Revoker = &MemoryStore{}
+
+// MemoryStore keeps revocations in memory, it's meant for tests and single instance services
+type MemoryStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: map[string]time.Time{}, users: map[string]time.Time{}}
+}
+
+// IsRevoked returns true if the token ID or every token for the user issued before issuedAt was revoked
+func (s *MemoryStore) IsRevoked(ctx context.Context, tokenID, userUUID string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if expiresAt, ok := s.tokens[tokenID]; ok && time.Now().Before(expiresAt) {
+		return true, nil
+	}
+	if issuedBefore, ok := s.users[userUUID]; ok && issuedBeforeRevoked(issuedAt, issuedBefore) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// RevokeToken revokes the token until it expires
+func (s *MemoryStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop the revocations of tokens that have expired anyway
+	for id, tokenExpiresAt := range s.tokens {
+		if !now.Before(tokenExpiresAt) {
+			delete(s.tokens, id)
+		}
+	}
+
+	if expiresAt.After(s.tokens[tokenID]) {
+		s.tokens[tokenID] = expiresAt
+	}
+	return nil
+}
+
+// RevokeUser revokes every token for the user issued before issuedBefore
+func (s *MemoryStore) RevokeUser(ctx context.Context, userUUID string, issuedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if issuedBefore.After(s.users[userUUID]) {
+		s.users[userUUID] = issuedBefore
+	}
+	return nil
+}
+
+// issuedBeforeRevoked returns true if a token issued at issuedAt is revoked by a user revocation at issuedBefore.
+// JWTs only have the second they were issued, so tokens issued in the same second as the revocation are kept
+// to avoid revoking the token a user gets right after logging out everywhere
+func issuedBeforeRevoked(issuedAt, issuedBefore time.Time) bool {
+	return issuedAt.Before(issuedBefore.Truncate(time.Second))
+}
@@ -0,0 +1,100 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/database/connector"
+)
+
+// Schema creates the tables the postgres store uses
+const Schema = `CREATE TABLE IF NOT EXISTS revoked_token (
+	token_id   text PRIMARY KEY,
+	expires_at timestamptz NOT NULL
+);
+CREATE TABLE IF NOT EXISTS revoked_user (
+	user_uuid     text PRIMARY KEY,
+	issued_before timestamptz NOT NULL
+)`
+
+const (
+	selectRevoked = `SELECT
+	EXISTS (SELECT 1 FROM revoked_token WHERE token_id = $1 AND expires_at > now())
+	OR EXISTS (SELECT 1 FROM revoked_user WHERE user_uuid = $2 AND date_trunc('second', issued_before) > $3)`
+
+	upsertToken = `INSERT INTO revoked_token (token_id, expires_at) VALUES ($1, $2)
+	ON CONFLICT (token_id) DO UPDATE SET expires_at = GREATEST(revoked_token.expires_at, EXCLUDED.expires_at)`
+
+	upsertUser = `INSERT INTO revoked_user (user_uuid, issued_before) VALUES ($1, $2)
+	ON CONFLICT (user_uuid) DO UPDATE SET issued_before = GREATEST(revoked_user.issued_before, EXCLUDED.issued_before)`
+
+	deleteExpiredTokens = `DELETE FROM revoked_token WHERE expires_at <= now()`
+)
+
+var _ middleware.RevocationChecker = &PostgresStore{}
+var _ middleware.Revoker = &PostgresStore{}
+
+// PostgresStore keeps revocations in the revoked_token and revoked_user tables (see Schema) so they are shared by every instance
+type PostgresStore struct {
+	connector connector.SQLDBConnector
+}
+
+// NewPostgresStore creates a PostgresStore that gets its connection from the connector
+func NewPostgresStore(dbConnector connector.SQLDBConnector) *PostgresStore {
+	return &PostgresStore{connector: dbConnector}
+}
+
+// IsRevoked returns true if the token ID or every token for the user issued before issuedAt was revoked
+func (s *PostgresStore) IsRevoked(ctx context.Context, tokenID, userUUID string, issuedAt time.Time) (bool, error) {
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return false, err
+	}
+
+	var revoked bool
+	if err := db.QueryRowContext(ctx, selectRevoked, tokenID, userUUID, issuedAt).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("could not check revocation: %v", err)
+	}
+	return revoked, nil
+}
+
+// RevokeToken revokes the token until it expires
+func (s *PostgresStore) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, upsertToken, tokenID, expiresAt); err != nil {
+		return fmt.Errorf("could not revoke token: %v", err)
+	}
+	return nil
+}
+
+// RevokeUser revokes every token for the user issued before issuedBefore
+func (s *PostgresStore) RevokeUser(ctx context.Context, userUUID string, issuedBefore time.Time) error {
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, upsertUser, userUUID, issuedBefore); err != nil {
+		return fmt.Errorf("could not revoke user: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the revocations of tokens that have expired, it can be run periodically to keep the table small
+func (s *PostgresStore) DeleteExpired(ctx context.Context) error {
+	db, err := s.connector.GetConnection()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, deleteExpiredTokens); err != nil {
+		return fmt.Errorf("could not delete expired revocations: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package revocation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/promoboxx/go-auth/src/auth"
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_MemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+
+	require.NoError(t, store.RevokeToken(ctx, "token-1", now.Add(time.Hour)))
+	require.NoError(t, store.RevokeToken(ctx, "token-2", now.Add(-time.Second)))
+	require.NoError(t, store.RevokeUser(ctx, "user-1", now))
+
+	testCases := []struct {
+		name     string
+		tokenID  string
+		userUUID string
+		issuedAt time.Time
+		expected bool
+	}{
+		{name: "revoked token", tokenID: "token-1", userUUID: "user-2", issuedAt: now, expected: true},
+		{name: "expired revocation", tokenID: "token-2", userUUID: "user-2", issuedAt: now, expected: false},
+		{name: "user token issued before", tokenID: "token-3", userUUID: "user-1", issuedAt: now.Add(-time.Hour), expected: true},
+		{name: "user token issued after", tokenID: "token-3", userUUID: "user-1", issuedAt: now.Add(time.Second), expected: false},
+		{name: "other user", tokenID: "token-3", userUUID: "user-2", issuedAt: now.Add(-time.Hour), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			revoked, err := store.IsRevoked(ctx, tc.tokenID, tc.userUUID, tc.issuedAt)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, revoked)
+		})
+	}
+}
+
+func TestUnit_FileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("tokens:\n  - token-1\nusers:\n  user-1: 2024-03-01T12:00:00Z\n"), 0o600))
+
+	store, err := NewFileStore(context.Background(), path, 0, logrus.NewEntry(logrus.New()))
+	require.NoError(t, err)
+
+	revoked, err := store.IsRevoked(context.Background(), "token-1", "user-2", time.Now())
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = store.IsRevoked(context.Background(), "token-2", "user-1", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = store.IsRevoked(context.Background(), "token-2", "user-1", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
+
+func TestUnit_LogOutEverywhere(t *testing.T) {
+	store := NewMemoryStore()
+	claims := auth.NewClaim(nil, nil, nil, time.Now().Add(time.Hour), nil, nil, []string{auth.RoleUser}, 7, "user-1", 0, "", nil)
+
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r = r.WithContext(context.WithValue(r.Context(), contextkey.ContextKeyClaims, claims))
+	w := httptest.NewRecorder()
+	middleware.LogOutEverywhere(store).ServeHTTP(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	revoked, err := store.IsRevoked(context.Background(), "token-1", "user-1", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.True(t, revoked)
+}
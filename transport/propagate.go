@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/trace"
+)
+
+const headerAuthorization = "Authorization"
+
+type propagatingTransport struct {
+	base       http.RoundTripper
+	trustedJWT []string
+}
+
+// NewPropagatingTransport returns a RoundTripper that copies the request ID, canary version and trace context
+// of the request context onto outbound requests. The JWT is only forwarded to hosts in jwtHosts, entries that
+// start with a "." match any subdomain (".svc.cluster.local"). Headers already set on the request are left alone.
+// If base is nil http.DefaultTransport is used.
+//
+// Expected usage:
+// client := &http.Client{Transport: transport.NewPropagatingTransport(nil, []string{".service.consul"})}
+// req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, "http://user.service.consul/user/1", nil)
+// resp, err := client.Do(req)
+func NewPropagatingTransport(base http.RoundTripper, jwtHosts []string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	trusted := make([]string, 0, len(jwtHosts))
+	for _, host := range jwtHosts {
+		trusted = append(trusted, strings.ToLower(host))
+	}
+
+	return &propagatingTransport{base: base, trustedJWT: trusted}
+}
+
+// RoundTrip adds the propagated headers to a copy of the request and sends it with the base transport
+func (t *propagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	out := req.Clone(ctx)
+
+	if requestID, err := middleware.GetRequestIDFromCtx(ctx); err == nil && requestID != "" {
+		setIfMissing(out.Header, middleware.HeaderRequestID, requestID)
+	}
+
+	if canary, err := middleware.GetCanaryVersionFromCtx(ctx); err == nil && canary != "" {
+		setIfMissing(out.Header, middleware.HeaderCanaryVersion, canary)
+	}
+
+	if jwt, err := middleware.GetJWTFromCtx(ctx); err == nil && jwt != "" && t.isTrusted(out.URL.Hostname()) {
+		setIfMissing(out.Header, headerAuthorization, jwt)
+	}
+
+	trace.Inject(ctx, out.Header)
+
+	return t.base.RoundTrip(out)
+}
+
+// isTrusted returns true if the JWT may be sent to the host
+func (t *propagatingTransport) isTrusted(host string) bool {
+	host = strings.ToLower(host)
+	for _, trusted := range t.trustedJWT {
+		if strings.HasPrefix(trusted, ".") {
+			if strings.HasSuffix(host, trusted) {
+				return true
+			}
+			continue
+		}
+
+		if host == trusted {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setIfMissing(h http.Header, key, value string) {
+	if h.Get(key) == "" {
+		h.Set(key, value)
+	}
+}
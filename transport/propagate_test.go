@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/promoboxx/go-service/alice/middleware"
+	"github.com/promoboxx/go-service/alice/middleware/contextkey"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestUnit_PropagatingTransport(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextkey.ContextKeyRequestID, "req-1")
+	ctx = context.WithValue(ctx, contextkey.ContextKeyCanary, "v2")
+	ctx = context.WithValue(ctx, contextkey.ContextKeyJWT, "Bearer token")
+
+	tests := map[string]struct {
+		url      string
+		validate func(t *testing.T, sent *http.Request)
+	}{
+		"internal host gets every header": {
+			url: "http://user.service.consul/users",
+			validate: func(t *testing.T, sent *http.Request) {
+				require.Equal(t, "req-1", sent.Header.Get(middleware.HeaderRequestID))
+				require.Equal(t, "v2", sent.Header.Get(middleware.HeaderCanaryVersion))
+				require.Equal(t, "Bearer token", sent.Header.Get("Authorization"))
+			},
+		},
+		"exact host match gets the JWT": {
+			url: "http://wallet:8080/balance",
+			validate: func(t *testing.T, sent *http.Request) {
+				require.Equal(t, "Bearer token", sent.Header.Get("Authorization"))
+			},
+		},
+		"external host does not get the JWT": {
+			url: "https://api.example.com/things",
+			validate: func(t *testing.T, sent *http.Request) {
+				require.Equal(t, "req-1", sent.Header.Get(middleware.HeaderRequestID))
+				require.Empty(t, sent.Header.Get("Authorization"))
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var sent *http.Request
+			base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				sent = r
+				return httptest.NewRecorder().Result(), nil
+			})
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, tc.url, nil)
+			require.NoError(t, err)
+
+			_, err = NewPropagatingTransport(base, []string{".service.consul", "wallet"}).RoundTrip(req)
+			require.NoError(t, err)
+			require.Empty(t, req.Header, "original request should not be modified")
+			tc.validate(t, sent)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package uuid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	googleuuid "github.com/google/uuid"
+)
+
+// NewV7 returns a version 7 uuid string. The first 48 bits are the unix time in milliseconds
+// so the uuids sort by the time they were created, the rest is random
+func NewV7() string {
+	var u googleuuid.UUID
+	_, err := rand.Read(u[6:])
+	if err != nil {
+		// crypto/rand should never fail, but fall back to a v4 uuid rather than a predictable one
+		return googleuuid.New().String()
+	}
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(u[:6], ms[2:])
+
+	u[6] = (u[6] & 0x0f) | 0x70 // version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return u.String()
+}
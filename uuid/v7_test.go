@@ -0,0 +1,22 @@
+package uuid
+
+import (
+	"testing"
+	"time"
+
+	googleuuid "github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnit_NewV7(t *testing.T) {
+	first := NewV7()
+	time.Sleep(2 * time.Millisecond)
+	second := NewV7()
+
+	require.True(t, IsValid(first))
+	require.Less(t, first, second, "uuids should sort by creation time")
+
+	parsed := googleuuid.MustParse(first)
+	require.Equal(t, googleuuid.Version(7), parsed.Version())
+	require.Equal(t, googleuuid.RFC4122, parsed.Variant())
+}